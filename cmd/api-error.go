@@ -4,7 +4,9 @@ import (
 	"context"
 	"encoding/xml"
 	"fmt"
+	"io"
 	"net/http"
+	"s3Gateway/internal/hash"
 )
 
 // APIError structure
@@ -170,6 +172,7 @@ const (
 
 	ErrNoAccessKey
 	ErrInvalidToken
+	ErrExpiredToken
 
 	// Bucket notification related errors.
 	ErrEventNotification
@@ -342,7 +345,10 @@ func (e errorCodeMap) ToAPIErrWithErr(errCode APIErrorCode, err error) *APIError
 		apiErr = e[ErrInternalError]
 	}
 	if err != nil {
-		apiErr.Description = fmt.Sprintf("%s (%s)", apiErr.Description, err)
+		//复制一份, 不修改全局的错误描述
+		withErr := *apiErr
+		withErr.Description = fmt.Sprintf("%s (%s)", apiErr.Description, err)
+		return &withErr
 	}
 	return apiErr
 }
@@ -1056,6 +1062,11 @@ var errorCodes = errorCodeMap{
 		Description:    "The security token included in the request is invalid",
 		HTTPStatusCode: http.StatusForbidden,
 	},
+	ErrExpiredToken: {
+		Code:           "ExpiredToken",
+		Description:    "The provided token has expired.",
+		HTTPStatusCode: http.StatusBadRequest,
+	},
 
 	/// S3 extensions.
 	ErrContentSHA256Mismatch: {
@@ -1757,6 +1768,25 @@ func toAPIErrorCode(ctx context.Context, err error) (apiErr APIErrorCode) {
 		apiErr = ErrEntityTooLarge
 	case errDataTooSmall:
 		apiErr = ErrEntityTooSmall
+	case errMalformedEncoding, errLineTooLong, io.ErrUnexpectedEOF:
+		apiErr = ErrIncompleteBody
+	case errUploadIDNotFound:
+		apiErr = ErrNoSuchUpload
+	case errInvalidPart:
+		apiErr = ErrInvalidPart
+	case errInvalidPartOrder:
+		apiErr = ErrInvalidPartOrder
+	case errPartTooSmall:
+		apiErr = ErrEntityTooSmall
+	}
+
+	switch err.(type) {
+	case hash.BadDigest:
+		apiErr = ErrBadDigest
+	case hash.SHA256Mismatch:
+		apiErr = ErrContentSHA256Mismatch
+	case hash.ErrSizeMismatch:
+		apiErr = ErrIncompleteBody
 	}
 
 	// Compression errors
@@ -1770,7 +1800,7 @@ func toAPIErrorCode(ctx context.Context, err error) (apiErr APIErrorCode) {
 		return apiErr
 	}
 
-	return apiErr
+	return ErrInternalError
 }
 
 var noError = APIError{}
@@ -40,6 +40,12 @@ func WriteSuccessResponseXML(w http.ResponseWriter, response []byte) {
 	WriteResponse(w, http.StatusOK, response, mimeXML)
 }
 
+// WriteSuccessResponseJSON writes success headers and response if any,
+// with content-type set to `application/json`.
+func WriteSuccessResponseJSON(w http.ResponseWriter, response []byte) {
+	WriteResponse(w, http.StatusOK, response, mimeJSON)
+}
+
 // WriteSuccessNoContent writes success headers with http status 204
 func WriteSuccessNoContent(w http.ResponseWriter) {
 	WriteResponse(w, http.StatusNoContent, nil, mimeNone)
@@ -51,6 +57,25 @@ func WriteRedirectSeeOther(w http.ResponseWriter, location string) {
 	WriteResponse(w, http.StatusSeeOther, nil, mimeNone)
 }
 
+//setObjectHeaders 写入对象相关的响应头
+func setObjectHeaders(w http.ResponseWriter, objInfo ObjectInfo) {
+	for k, v := range objInfo.UserDefined {
+		w.Header().Set(k, v)
+	}
+	if objInfo.ETag != "" {
+		w.Header().Set(xhttp.ETag, "\""+objInfo.ETag+"\"")
+	}
+	if objInfo.ContentType != "" {
+		w.Header().Set(xhttp.ContentType, objInfo.ContentType)
+	}
+	if !objInfo.ModTime.IsZero() {
+		w.Header().Set(xhttp.LastModified, objInfo.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if objInfo.Size >= 0 {
+		w.Header().Set(xhttp.ContentLength, strconv.FormatInt(objInfo.Size, 10))
+	}
+}
+
 func WriteSuccessResponseHeadersOnly(w http.ResponseWriter) {
 	WriteResponse(w, http.StatusOK, nil, mimeNone)
 }
@@ -63,17 +88,9 @@ func WriteErrorResponse(ctx context.Context, w http.ResponseWriter, err *APIErro
 		// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Retry-After
 		w.Header().Set(xhttp.RetryAfter, "120")
 	case "InvalidRegion":
-		err.Description = fmt.Sprintf("Region does not match; expecting '%s'.", globalServerRegion)
+		err.Description = fmt.Sprintf("Region does not match; expecting '%s'.", serverRegion())
 	case "AuthorizationHeaderMalformed":
-		err.Description = fmt.Sprintf("The authorization header is malformed; the region is wrong; expecting '%s'.", globalServerRegion)
-	case "AccessDenied":
-		// The request is from browser and also if browser
-		// is enabled we need to redirect.
-		if browser {
-			w.Header().Set(xhttp.Location, reqURL.Path)
-			w.WriteHeader(http.StatusTemporaryRedirect)
-			return
-		}
+		err.Description = fmt.Sprintf("The authorization header is malformed; the region is wrong; expecting '%s'.", serverRegion())
 	}
 
 	bucketName, ok := ctx.Value("bucketName").(string)
@@ -88,8 +105,11 @@ func WriteErrorResponse(ctx context.Context, w http.ResponseWriter, err *APIErro
 	if !ok {
 		region = ""
 	}
+	if reqInfo, ok := GetReqInfo(ctx); ok {
+		reqInfo.ErrorCode = err.Code
+	}
 	// Generate error response.
-	errorResponse := getAPIErrorResponse(bucketName, objectName, region, err, reqURL.Path, w.Header().Get(xhttp.AmzRequestID), "-")
+	errorResponse := getAPIErrorResponse(bucketName, objectName, region, err, reqURL.Path, w.Header().Get(xhttp.AmzRequestID), w.Header().Get(xhttp.AmzRequestHostID))
 	encodedErrorResponse := EncodeResponse(errorResponse)
 	WriteResponse(w, err.HTTPStatusCode, encodedErrorResponse, mimeXML)
 }
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"github.com/minio/pkg/bucket/policy"
+	iampolicy "github.com/minio/pkg/iam/policy"
+)
+
+//s3 接口名称及鉴权时使用的策略操作, 访问日志记录接口名称及操作
+
+const (
+	apiListBuckets             = "ListBuckets"
+	apiCreateBucket            = "CreateBucket"
+	apiHeadBucket              = "HeadBucket"
+	apiDeleteBucket            = "DeleteBucket"
+	apiGetBucketLocation       = "GetBucketLocation"
+	apiPutBucketPolicy         = "PutBucketPolicy"
+	apiGetBucketPolicy         = "GetBucketPolicy"
+	apiDeleteBucketPolicy      = "DeleteBucketPolicy"
+	apiListObjectsV1           = "ListObjectsV1"
+	apiListObjectsV2           = "ListObjectsV2"
+	apiListMultipartUploads    = "ListMultipartUploads"
+	apiHeadObject              = "HeadObject"
+	apiGetObject               = "GetObject"
+	apiPutObject               = "PutObject"
+	apiPostObject              = "PostObject"
+	apiCopyObject              = "CopyObject"
+	apiDeleteObject            = "DeleteObject"
+	apiDeleteMultipleObjects   = "DeleteMultipleObjects"
+	apiNewMultipartUpload      = "NewMultipartUpload"
+	apiPutObjectPart           = "PutObjectPart"
+	apiCopyObjectPart          = "CopyObjectPart"
+	apiCompleteMultipartUpload = "CompleteMultipartUpload"
+	apiAbortMultipartUpload    = "AbortMultipartUpload"
+	apiListObjectParts         = "ListObjectParts"
+
+	apiAdminListPolicies = "AdminListPolicies"
+	apiAdminGetPolicy    = "AdminGetPolicy"
+	apiAdminPutPolicy    = "AdminPutPolicy"
+	apiAdminDeletePolicy = "AdminDeletePolicy"
+	apiAdminListUsers    = "AdminListUsers"
+	apiAdminGetUser      = "AdminGetUser"
+	apiAdminPutUser      = "AdminPutUser"
+	apiAdminDeleteUser   = "AdminDeleteUser"
+	apiAdminListGroups   = "AdminListGroups"
+	apiAdminGetGroup     = "AdminGetGroup"
+	apiAdminPutGroup     = "AdminPutGroup"
+	apiAdminDeleteGroup  = "AdminDeleteGroup"
+
+	apiSTS             = "STS"
+	apiAssumeRole      = "AssumeRole"
+	apiGetSessionToken = "GetSessionToken"
+
+	apiPresign = "Presign"
+)
+
+// apiActions 接口 -> 策略操作, 与 s3 的权限要求一致
+var apiActions = map[string]policy.Action{
+	apiListBuckets:             policy.ListAllMyBucketsAction,
+	apiCreateBucket:            policy.CreateBucketAction,
+	apiHeadBucket:              policy.ListBucketAction,
+	apiDeleteBucket:            policy.DeleteBucketAction,
+	apiGetBucketLocation:       policy.GetBucketLocationAction,
+	apiPutBucketPolicy:         policy.PutBucketPolicyAction,
+	apiGetBucketPolicy:         policy.GetBucketPolicyAction,
+	apiDeleteBucketPolicy:      policy.DeleteBucketPolicyAction,
+	apiListObjectsV1:           policy.ListBucketAction,
+	apiListObjectsV2:           policy.ListBucketAction,
+	apiListMultipartUploads:    policy.ListBucketMultipartUploadsAction,
+	apiHeadObject:              policy.GetObjectAction,
+	apiGetObject:               policy.GetObjectAction,
+	apiPutObject:               policy.PutObjectAction,
+	apiPostObject:              policy.PutObjectAction,
+	apiCopyObject:              policy.PutObjectAction,
+	apiDeleteObject:            policy.DeleteObjectAction,
+	apiDeleteMultipleObjects:   policy.DeleteObjectAction,
+	apiNewMultipartUpload:      policy.PutObjectAction,
+	apiPutObjectPart:           policy.PutObjectAction,
+	apiCopyObjectPart:          policy.PutObjectAction,
+	apiCompleteMultipartUpload: policy.PutObjectAction,
+	apiAbortMultipartUpload:    policy.AbortMultipartUploadAction,
+	apiListObjectParts:         policy.ListMultipartUploadPartsAction,
+
+	apiAdminListPolicies: iampolicy.ListUserPoliciesAdminAction,
+	apiAdminGetPolicy:    iampolicy.GetPolicyAdminAction,
+	apiAdminPutPolicy:    iampolicy.CreatePolicyAdminAction,
+	apiAdminDeletePolicy: iampolicy.DeletePolicyAdminAction,
+	apiAdminListUsers:    iampolicy.ListUsersAdminAction,
+	apiAdminGetUser:      iampolicy.GetUserAdminAction,
+	apiAdminPutUser:      iampolicy.CreateUserAdminAction,
+	apiAdminDeleteUser:   iampolicy.DeleteUserAdminAction,
+	apiAdminListGroups:   iampolicy.ListGroupsAdminAction,
+	apiAdminGetGroup:     iampolicy.GetGroupAdminAction,
+	apiAdminPutGroup:     iampolicy.AddUserToGroupAdminAction,
+	apiAdminDeleteGroup:  iampolicy.RemoveUserFromGroupAdminAction,
+}
@@ -21,6 +21,7 @@ import (
 	"context"
 	"encoding/hex"
 	"github.com/minio/pkg/bucket/policy"
+	iampolicy "github.com/minio/pkg/iam/policy"
 	"net/http"
 	"s3Gateway/internal/auth"
 	"s3Gateway/internal/etag"
@@ -210,7 +211,7 @@ func validateSignature(ctx context.Context, atype authType, r *http.Request) (au
 		}
 		cred, owner, s3Err = getReqAccessKeyV2(r)
 	case authTypePresigned, authTypeSigned:
-		region := globalServerRegion
+		region := serverRegion()
 		if s3Err = isReqAuthenticated(ctx, r, region, serviceS3); s3Err != ErrNone {
 			return cred, owner, nil, s3Err
 		}
@@ -249,7 +250,7 @@ func checkRequestAuthTypeCredential(ctx context.Context, r *http.Request, action
 		}
 		cred, owner, s3Err = getReqAccessKeyV2(r)
 	case authTypeSigned, authTypePresigned:
-		region := globalServerRegion
+		region := serverRegion()
 		switch action {
 		case policy.GetBucketLocationAction, policy.ListAllMyBucketsAction:
 			region = ""
@@ -262,5 +263,75 @@ func checkRequestAuthTypeCredential(ctx context.Context, r *http.Request, action
 	if s3Err != ErrNone {
 		return cred, owner, s3Err
 	}
+	if cred, s3Err = checkRequestPolicies(ctx, r, action, bucketName, objectName, cred); s3Err != ErrNone {
+		return cred, owner, s3Err
+	}
 	return cred, owner, ErrNone
 }
+
+// checkRequestPolicies authorizes a request whose signature is already verified,
+// returns the credentials to access the storage backend with.
+func checkRequestPolicies(ctx context.Context, r *http.Request, action policy.Action, bucketName, objectName string, cred auth.Credentials) (_ auth.Credentials, s3Err APIErrorCode) {
+	if cred, s3Err = resolveCredentials(r, action, bucketName, objectName, cred); s3Err != ErrNone {
+		return cred, s3Err
+	}
+	// Record the caller for the access log, also when the request is denied below.
+	if reqInfo, ok := GetReqInfo(ctx); ok {
+		reqInfo.AccessKey = cred.AccessKey
+	}
+	return checkCredentialPolicies(r, action, bucketName, objectName, cred)
+}
+
+// checkCopySourcePolicies authorizes reading the source of a server side copy
+// with the credentials that signed the request. Unlike checkRequestPolicies the
+// request info is left untouched, it keeps the caller of the destination.
+func checkCopySourcePolicies(r *http.Request, bucketName, objectName string, cred auth.Credentials) (_ auth.Credentials, s3Err APIErrorCode) {
+	if cred, s3Err = resolveCredentials(r, policy.GetObjectAction, bucketName, objectName, cred); s3Err != ErrNone {
+		return cred, s3Err
+	}
+	return checkCredentialPolicies(r, policy.GetObjectAction, bucketName, objectName, cred)
+}
+
+// resolveCredentials returns the parent user of temporary credentials, which act
+// on its behalf limited by the session policy. Other credentials are returned as is.
+func resolveCredentials(r *http.Request, action policy.Action, bucketName, objectName string, cred auth.Credentials) (auth.Credentials, APIErrorCode) {
+	if !cred.IsTemp() {
+		return cred, ErrNone
+	}
+	if s3Err := checkSessionPolicy(r, action, bucketName, objectName, cred); s3Err != ErrNone {
+		return cred, s3Err
+	}
+	return parentCredentials(cred)
+}
+
+// checkCredentialPolicies evaluates the IAM and bucket policies for resolved credentials.
+func checkCredentialPolicies(r *http.Request, action policy.Action, bucketName, objectName string, cred auth.Credentials) (auth.Credentials, APIErrorCode) {
+	// Signed requests are subject to the IAM policies of the user and its groups.
+	if cred.AccessKey != "" {
+		if s3Err := checkIAMPolicy(r, action, bucketName, objectName, cred); s3Err != ErrNone {
+			return cred, s3Err
+		}
+	}
+	// Anonymous and signed requests are both subject to the bucket policy.
+	return checkBucketPolicy(r, action, bucketName, objectName, cred)
+}
+
+// checkAdminRequestAuth validates the signature of an admin API request, the
+// caller must be listed in iam.admins or be granted the admin action by IAM policies.
+// Temporary credentials are not accepted.
+func checkAdminRequestAuth(ctx context.Context, r *http.Request, action iampolicy.AdminAction) (auth.Credentials, APIErrorCode) {
+	cred, _, _, s3Err := validateSignature(ctx, getRequestAuthType(r), r)
+	if s3Err != ErrNone {
+		return cred, s3Err
+	}
+	if cred.AccessKey == "" || cred.IsTemp() {
+		return cred, ErrAccessDenied
+	}
+	if reqInfo, ok := GetReqInfo(ctx); ok {
+		reqInfo.AccessKey = cred.AccessKey
+	}
+	if !isIAMAdminAllowed(r, action, cred) {
+		return cred, ErrAccessDenied
+	}
+	return cred, ErrNone
+}
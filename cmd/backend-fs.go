@@ -0,0 +1,451 @@
+package cmd
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/minio/minio-go/v7/pkg/s3utils"
+	xhttp "s3Gateway/internal/http"
+	"s3Gateway/internal/logger"
+)
+
+//本地文件系统后端, 桶对应目录, 对象对应文件
+//元数据保存在 <root>/.s3gateway.sys/buckets/<bucket>/<object>/fs.json
+//桶配置保存在 <root>/.s3gateway.sys/config/<bucket>/bucket.json
+
+const (
+	fsMetaBucket       = ".s3gateway.sys"
+	fsMetaJSONFile     = "fs.json"
+	fsBucketConfigFile = "bucket.json"
+)
+
+// FsBackend 本地文件系统实现
+type FsBackend struct {
+	root  string
+	users map[string]string
+}
+
+// fsMetadata 对象元数据
+type fsMetadata struct {
+	ETag        string            `json:"etag"`
+	UserDefined map[string]string `json:"meta,omitempty"`
+	Parts       []ObjectPartInfo  `json:"parts,omitempty"`
+}
+
+// fsBucketConfig 桶配置
+type fsBucketConfig struct {
+	Location string `json:"location"`
+}
+
+func NewFsBackend(root string, users map[string]string) (*FsBackend, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range []string{root, filepath.Join(root, fsMetaBucket, "buckets"), filepath.Join(root, fsMetaBucket, "tmp")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &FsBackend{root: root, users: users}, nil
+}
+
+func (fs *FsBackend) UserSecret(accessKey string) (string, error) {
+	secretKey, ok := fs.users[accessKey]
+	if !ok {
+		return "", errNoSuchUser
+	}
+	return secretKey, nil
+}
+
+func (fs *FsBackend) bucketDir(bucket string) string {
+	return filepath.Join(fs.root, bucket)
+}
+
+func (fs *FsBackend) bucketMetaDir(bucket string) string {
+	return filepath.Join(fs.root, fsMetaBucket, "buckets", bucket)
+}
+
+func (fs *FsBackend) bucketConfigDir(bucket string) string {
+	return filepath.Join(fs.root, fsMetaBucket, "config", bucket)
+}
+
+func (fs *FsBackend) objectPath(bucket, object string) string {
+	return filepath.Join(fs.bucketDir(bucket), filepath.FromSlash(object))
+}
+
+func (fs *FsBackend) objectMetaPath(bucket, object string) string {
+	return filepath.Join(fs.bucketMetaDir(bucket), filepath.FromSlash(object), fsMetaJSONFile)
+}
+
+//checkBucket 校验桶名并确认桶存在
+func (fs *FsBackend) checkBucket(bucket string) *APIError {
+	if s3utils.CheckValidBucketName(bucket) != nil {
+		return errorCodes.ToAPIErr(ErrInvalidBucketName)
+	}
+	fi, err := os.Stat(fs.bucketDir(bucket))
+	if err != nil || !fi.IsDir() {
+		return errorCodes.ToAPIErr(ErrNoSuchBucket)
+	}
+	return nil
+}
+
+//checkObjectName 拒绝会逃逸出桶目录的对象名
+func checkObjectName(object string) *APIError {
+	if s3utils.CheckValidObjectName(object) != nil {
+		return errorCodes.ToAPIErr(ErrInvalidObjectName)
+	}
+	for _, elem := range strings.Split(object, SlashSeparator) {
+		if elem == "." || elem == ".." {
+			return errorCodes.ToAPIErr(ErrInvalidObjectName)
+		}
+	}
+	return nil
+}
+
+func (fs *FsBackend) CreateBucket(ctx context.Context, bucket, location string) *APIError {
+	if s3utils.CheckValidBucketNameStrict(bucket) != nil {
+		return errorCodes.ToAPIErr(ErrInvalidBucketName)
+	}
+	if err := os.Mkdir(fs.bucketDir(bucket), 0755); err != nil {
+		if os.IsExist(err) {
+			return errorCodes.ToAPIErr(ErrBucketAlreadyOwnedByYou)
+		}
+		logger.Error("create bucket %s error:%s", bucket, err.Error())
+		return errorCodes.ToAPIErr(ErrInternalError)
+	}
+	if err := fs.writeBucketConfig(bucket, fsBucketConfig{Location: location}); err != nil {
+		logger.Error("write bucket %s config error:%s", bucket, err.Error())
+		os.Remove(fs.bucketDir(bucket))
+		return errorCodes.ToAPIErr(ErrInternalError)
+	}
+	return nil
+}
+
+func (fs *FsBackend) HeadBucket(ctx context.Context, bucket string) *APIError {
+	return fs.checkBucket(bucket)
+}
+
+func (fs *FsBackend) GetBucketInfo(ctx context.Context, bucket string) (BucketInfo, *APIError) {
+	if s3Err := fs.checkBucket(bucket); s3Err != nil {
+		return BucketInfo{}, s3Err
+	}
+	fi, err := os.Stat(fs.bucketDir(bucket))
+	if err != nil {
+		return BucketInfo{}, errorCodes.ToAPIErr(ErrNoSuchBucket)
+	}
+	config, err := fs.readBucketConfig(bucket)
+	if err != nil && !os.IsNotExist(err) {
+		logger.Error("read bucket %s config error:%s", bucket, err.Error())
+		return BucketInfo{}, errorCodes.ToAPIErr(ErrInternalError)
+	}
+	return BucketInfo{Name: bucket, Created: fi.ModTime(), Location: config.Location}, nil
+}
+
+func (fs *FsBackend) DeleteBucket(ctx context.Context, bucket string) *APIError {
+	if s3Err := fs.checkBucket(bucket); s3Err != nil {
+		return s3Err
+	}
+	entries, err := ioutil.ReadDir(fs.bucketDir(bucket))
+	if err != nil {
+		return errorCodes.ToAPIErr(ErrInternalError)
+	}
+	if len(entries) > 0 {
+		return errorCodes.ToAPIErr(ErrBucketNotEmpty)
+	}
+	if err := os.Remove(fs.bucketDir(bucket)); err != nil {
+		return errorCodes.ToAPIErr(ErrInternalError)
+	}
+	os.RemoveAll(fs.bucketMetaDir(bucket))
+	os.RemoveAll(fs.bucketConfigDir(bucket))
+	return nil
+}
+
+func (fs *FsBackend) ListBuckets(ctx context.Context) ([]BucketInfo, *APIError) {
+	entries, err := ioutil.ReadDir(fs.root)
+	if err != nil {
+		return nil, errorCodes.ToAPIErr(ErrInternalError)
+	}
+	buckets := make([]BucketInfo, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		buckets = append(buckets, BucketInfo{Name: entry.Name(), Created: entry.ModTime()})
+	}
+	return buckets, nil
+}
+
+func (fs *FsBackend) PutObject(ctx context.Context, bucket, object string, data io.Reader, size int64, opts ObjectOptions) (ObjectInfo, *APIError) {
+	if s3Err := fs.checkBucket(bucket); s3Err != nil {
+		return ObjectInfo{}, s3Err
+	}
+	if s3Err := checkObjectName(object); s3Err != nil {
+		return ObjectInfo{}, s3Err
+	}
+	tmp, err := ioutil.TempFile(filepath.Join(fs.root, fsMetaBucket, "tmp"), "put-")
+	if err != nil {
+		return ObjectInfo{}, errorCodes.ToAPIErr(ErrInternalError)
+	}
+	defer os.Remove(tmp.Name())
+	hasher := md5.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hasher), data)
+	tmp.Close()
+	if err != nil {
+		return ObjectInfo{}, errorCodes.ToAPIErr(ErrIncompleteBody)
+	}
+	if size >= 0 && n != size {
+		return ObjectInfo{}, errorCodes.ToAPIErr(ErrIncompleteBody)
+	}
+	meta := fsMetadata{
+		ETag:        hex.EncodeToString(hasher.Sum(nil)),
+		UserDefined: opts.UserDefined,
+		Parts:       opts.Parts,
+	}
+	if opts.ETag != "" {
+		meta.ETag = opts.ETag
+	}
+
+	target := fs.objectPath(bucket, object)
+	if strings.HasSuffix(object, SlashSeparator) {
+		//目录对象只记录元数据
+		err = os.MkdirAll(target, 0755)
+	} else if err = os.MkdirAll(filepath.Dir(target), 0755); err == nil {
+		err = os.Rename(tmp.Name(), target)
+	}
+	if err != nil {
+		logger.Error("put object %s/%s error:%s", bucket, object, err.Error())
+		return ObjectInfo{}, errorCodes.ToAPIErr(ErrInternalError)
+	}
+	if err := fs.writeMeta(bucket, object, meta); err != nil {
+		return ObjectInfo{}, errorCodes.ToAPIErr(ErrInternalError)
+	}
+	return fs.HeadObject(ctx, bucket, object)
+}
+
+func (fs *FsBackend) GetObject(ctx context.Context, bucket, object string, offset, length int64) (io.ReadCloser, ObjectInfo, *APIError) {
+	objInfo, s3Err := fs.HeadObject(ctx, bucket, object)
+	if s3Err != nil {
+		return nil, objInfo, s3Err
+	}
+	if strings.HasSuffix(object, SlashSeparator) {
+		return ioutil.NopCloser(strings.NewReader("")), objInfo, nil
+	}
+	fp, err := os.Open(fs.objectPath(bucket, object))
+	if err != nil {
+		return nil, objInfo, errorCodes.ToAPIErr(ErrNoSuchKey)
+	}
+	if offset > 0 {
+		if _, err := fp.Seek(offset, io.SeekStart); err != nil {
+			fp.Close()
+			return nil, objInfo, errorCodes.ToAPIErr(ErrInvalidRange)
+		}
+	}
+	if length < 0 {
+		return fp, objInfo, nil
+	}
+	return readCloser{io.LimitReader(fp, length), fp}, objInfo, nil
+}
+
+func (fs *FsBackend) CopyObject(ctx context.Context, srcBucket, srcObject, dstBucket, dstObject string, opts ObjectOptions) (ObjectInfo, *APIError) {
+	return copyObjectByStream(ctx, fs, srcBucket, srcObject, dstBucket, dstObject, opts)
+}
+
+func (fs *FsBackend) HeadObject(ctx context.Context, bucket, object string) (ObjectInfo, *APIError) {
+	if s3Err := fs.checkBucket(bucket); s3Err != nil {
+		return ObjectInfo{}, s3Err
+	}
+	if s3Err := checkObjectName(object); s3Err != nil {
+		return ObjectInfo{}, s3Err
+	}
+	fi, err := os.Stat(fs.objectPath(bucket, object))
+	if err != nil {
+		return ObjectInfo{}, errorCodes.ToAPIErr(ErrNoSuchKey)
+	}
+	isDirObject := strings.HasSuffix(object, SlashSeparator)
+	if fi.IsDir() != isDirObject {
+		return ObjectInfo{}, errorCodes.ToAPIErr(ErrNoSuchKey)
+	}
+	meta, err := fs.readMeta(bucket, object)
+	if err != nil && (isDirObject || !os.IsNotExist(err)) {
+		return ObjectInfo{}, errorCodes.ToAPIErr(ErrNoSuchKey)
+	}
+	return fs.objectInfo(bucket, object, fi, meta), nil
+}
+
+func (fs *FsBackend) objectInfo(bucket, object string, fi os.FileInfo, meta fsMetadata) ObjectInfo {
+	objInfo := ObjectInfo{
+		Bucket:       bucket,
+		Name:         object,
+		Size:         fi.Size(),
+		ETag:         meta.ETag,
+		ModTime:      fi.ModTime(),
+		StorageClass: "STANDARD",
+		UserDefined:  make(map[string]string, len(meta.UserDefined)),
+		Parts:        meta.Parts,
+	}
+	if fi.IsDir() {
+		objInfo.Size = 0
+	}
+	for k, v := range meta.UserDefined {
+		switch k {
+		case xhttp.ContentType:
+			objInfo.ContentType = v
+			continue
+		case "X-Amz-Storage-Class":
+			objInfo.StorageClass = v
+		}
+		objInfo.UserDefined[k] = v
+	}
+	if objInfo.ContentType == "" {
+		objInfo.ContentType = "application/octet-stream"
+	}
+	return objInfo
+}
+
+func (fs *FsBackend) DeleteObject(ctx context.Context, bucket, object string) *APIError {
+	if s3Err := fs.checkBucket(bucket); s3Err != nil {
+		return s3Err
+	}
+	if s3Err := checkObjectName(object); s3Err != nil {
+		return s3Err
+	}
+	target := fs.objectPath(bucket, object)
+	fi, err := os.Stat(target)
+	if err != nil {
+		//s3 删除不存在的对象同样返回成功
+		return nil
+	}
+	if fi.IsDir() {
+		if !strings.HasSuffix(object, SlashSeparator) {
+			return nil
+		}
+		//目录对象, 目录下仍有对象时只删除元数据
+		os.Remove(target)
+	} else if err := os.Remove(target); err != nil {
+		return errorCodes.ToAPIErr(ErrInternalError)
+	}
+	metaPath := fs.objectMetaPath(bucket, object)
+	os.Remove(metaPath)
+	fs.removeEmptyParents(filepath.Dir(target), fs.bucketDir(bucket))
+	fs.removeEmptyParents(filepath.Dir(metaPath), fs.bucketMetaDir(bucket))
+	return nil
+}
+
+//removeEmptyParents 从 dir 开始向上删除空目录, 直到 base
+func (fs *FsBackend) removeEmptyParents(dir, base string) {
+	for dir != base && strings.HasPrefix(dir, base) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func (fs *FsBackend) ListObjects(ctx context.Context, bucket, prefix string) ([]ObjectInfo, *APIError) {
+	if s3Err := fs.checkBucket(bucket); s3Err != nil {
+		return nil, s3Err
+	}
+	base := fs.bucketDir(bucket)
+	//只遍历 prefix 所在的目录
+	root := base
+	if i := strings.LastIndex(prefix, SlashSeparator); i > 0 {
+		root = filepath.Join(base, filepath.FromSlash(prefix[:i]))
+	}
+	var objects []ObjectInfo
+	err := filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if p == root && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if p == base {
+			return nil
+		}
+		object := filepath.ToSlash(strings.TrimPrefix(p, base+string(filepath.Separator)))
+		if fi.IsDir() {
+			object += SlashSeparator
+		}
+		if !strings.HasPrefix(object, prefix) {
+			//目录不匹配 prefix 时整个跳过
+			if fi.IsDir() && !strings.HasPrefix(prefix, object) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		meta, err := fs.readMeta(bucket, object)
+		if err != nil {
+			if fi.IsDir() || !os.IsNotExist(err) {
+				return nil
+			}
+		}
+		objects = append(objects, fs.objectInfo(bucket, object, fi, meta))
+		return nil
+	})
+	if err != nil {
+		return nil, errorCodes.ToAPIErr(ErrInternalError)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Name < objects[j].Name
+	})
+	return objects, nil
+}
+
+func (fs *FsBackend) readMeta(bucket, object string) (fsMetadata, error) {
+	meta := fsMetadata{}
+	buf, err := ioutil.ReadFile(fs.objectMetaPath(bucket, object))
+	if err != nil {
+		return meta, err
+	}
+	if err := json.Unmarshal(buf, &meta); err != nil {
+		return meta, errors.New("corrupted metadata " + path.Join(bucket, object))
+	}
+	return meta, nil
+}
+
+func (fs *FsBackend) writeMeta(bucket, object string, meta fsMetadata) error {
+	metaPath := fs.objectMetaPath(bucket, object)
+	if err := os.MkdirAll(filepath.Dir(metaPath), 0755); err != nil {
+		return err
+	}
+	buf, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(metaPath, buf, 0644)
+}
+
+//readBucketConfig 桶配置不存在时返回 os.ErrNotExist
+func (fs *FsBackend) readBucketConfig(bucket string) (fsBucketConfig, error) {
+	config := fsBucketConfig{}
+	buf, err := ioutil.ReadFile(filepath.Join(fs.bucketConfigDir(bucket), fsBucketConfigFile))
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(buf, &config); err != nil {
+		return config, errors.New("corrupted bucket config " + bucket)
+	}
+	return config, nil
+}
+
+func (fs *FsBackend) writeBucketConfig(bucket string, config fsBucketConfig) error {
+	if err := os.MkdirAll(fs.bucketConfigDir(bucket), 0755); err != nil {
+		return err
+	}
+	buf, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(fs.bucketConfigDir(bucket), fsBucketConfigFile), buf, 0644)
+}
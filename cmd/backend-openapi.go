@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	xhttp "s3Gateway/internal/http"
+	"s3Gateway/internal/logger"
+	mxml "s3Gateway/model/xml"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpenApiBackend 矩阵存储 open api 实现
+// open api 的上传接口没有元数据参数, Content-Type、x-amz-meta-* 及分片上传的 ETag 由 meta 保存在网关本地
+type OpenApiBackend struct {
+	meta *ObjectMetaStore
+}
+
+func NewOpenApiBackend(metaDir string) (*OpenApiBackend, error) {
+	meta, err := NewObjectMetaStore(metaDir)
+	if err != nil {
+		return nil, err
+	}
+	return &OpenApiBackend{meta: meta}, nil
+}
+
+func (*OpenApiBackend) UserSecret(accessKey string) (string, error) {
+	cs, err := UserSecret(accessKey)
+	if err != nil {
+		return "", err
+	}
+	return cs.Data, nil
+}
+
+func (*OpenApiBackend) CreateBucket(ctx context.Context, bucket, location string) *APIError {
+	return CreateBucket(ctx, bucket, location)
+}
+
+func (*OpenApiBackend) HeadBucket(ctx context.Context, bucket string) *APIError {
+	_, s3Err := HeadBucket(ctx, bucket)
+	return s3Err
+}
+
+func (*OpenApiBackend) GetBucketInfo(ctx context.Context, bucket string) (BucketInfo, *APIError) {
+	m, s3Err := HeadBucket(ctx, bucket)
+	if s3Err != nil {
+		return BucketInfo{}, s3Err
+	}
+	return BucketInfo{Name: bucket, Location: m.Data.Location}, nil
+}
+
+func (b *OpenApiBackend) DeleteBucket(ctx context.Context, bucket string) *APIError {
+	if s3Err := DelBucket(ctx, bucket); s3Err != nil {
+		return s3Err
+	}
+	if err := b.meta.DeleteBucket(bucket); err != nil {
+		logger.Error("delete bucket %s metadata error:%s", bucket, err.Error())
+	}
+	return nil
+}
+
+func (*OpenApiBackend) ListBuckets(ctx context.Context) ([]BucketInfo, *APIError) {
+	out, s3Err := ListBucket(ctx)
+	if s3Err != nil {
+		return nil, s3Err
+	}
+	list := mxml.ListBucket{}
+	decoder := xml.NewDecoder(strings.NewReader(out.Data.Data))
+	if err := decoder.Decode(&list); err != nil {
+		return nil, errorCodes.ToAPIErr(ErrMalformedXML)
+	}
+	buckets := make([]BucketInfo, 0, len(list.Buckets.Bucket))
+	for _, b := range list.Buckets.Bucket {
+		buckets = append(buckets, BucketInfo{Name: b.Name, Created: b.CreationDate})
+	}
+	return buckets, nil
+}
+
+func (b *OpenApiBackend) PutObject(ctx context.Context, bucket, object string, data io.Reader, size int64, opts ObjectOptions) (ObjectInfo, *APIError) {
+	credential, s3Err := FileUpdateCredential(ctx, bucket, object)
+	if s3Err != nil {
+		return ObjectInfo{}, s3Err
+	}
+	if _, s3Err = FileUpdate(ctx, data, credential, bucket, object, size, opts.UserDefined[xhttp.ContentType]); s3Err != nil {
+		return ObjectInfo{}, s3Err
+	}
+	meta := objectMeta{Size: size, ETag: opts.ETag, UserDefined: opts.UserDefined, Parts: opts.Parts}
+	if err := b.meta.Set(bucket, object, meta); err != nil {
+		logger.Error("save object %s/%s metadata error:%s", bucket, object, err.Error())
+		return ObjectInfo{}, errorCodes.ToAPIErr(ErrInternalError)
+	}
+	return ObjectInfo{Bucket: bucket, Name: object, Size: size, ETag: opts.ETag, Parts: opts.Parts}, nil
+}
+
+func (b *OpenApiBackend) GetObject(ctx context.Context, bucket, object string, offset, length int64) (io.ReadCloser, ObjectInfo, *APIError) {
+	m, s3Err := GetCid(ctx, bucket, object)
+	if s3Err != nil {
+		return nil, ObjectInfo{}, s3Err
+	}
+	byteRange := ""
+	if offset > 0 || length >= 0 {
+		byteRange = fmt.Sprintf("bytes=%d-", offset)
+		if length >= 0 {
+			byteRange += strconv.FormatInt(offset+length-1, 10)
+		}
+	}
+	rep, s3Err := DownloadFile(ctx, m.Data.StoreHost, m.Data.Cid, bucket, object, byteRange)
+	if s3Err != nil {
+		return nil, ObjectInfo{}, s3Err
+	}
+	header := make(map[string]string, len(rep.Header))
+	for k, v := range rep.Header {
+		if len(v) > 0 {
+			header[k] = v[0]
+		}
+	}
+	objInfo := objectInfoFromHeader(bucket, object, header)
+	objInfo.Size = rep.ContentLength
+	if rep.StatusCode == http.StatusPartialContent {
+		//Content-Range: bytes start-end/size
+		contentRange := rep.Header.Get(xhttp.ContentRange)
+		if i := strings.LastIndex(contentRange, "/"); i >= 0 {
+			objInfo.Size, _ = strconv.ParseInt(contentRange[i+1:], 10, 64)
+		}
+		delete(objInfo.UserDefined, xhttp.ContentRange)
+		return rep.Body, b.withMeta(objInfo), nil
+	}
+	objInfo = b.withMeta(objInfo)
+	//存储节点忽略了 Range, 在本地截取
+	if offset > 0 {
+		if _, err := io.CopyN(ioutil.Discard, rep.Body, offset); err != nil {
+			rep.Body.Close()
+			return nil, objInfo, errorCodes.ToAPIErr(ErrInvalidRange)
+		}
+	}
+	if length >= 0 {
+		return readCloser{io.LimitReader(rep.Body, length), rep.Body}, objInfo, nil
+	}
+	return rep.Body, objInfo, nil
+}
+
+func (b *OpenApiBackend) HeadObject(ctx context.Context, bucket, object string) (ObjectInfo, *APIError) {
+	headFile, s3Err := HeadFile(ctx, bucket, object)
+	if s3Err != nil {
+		return ObjectInfo{}, s3Err
+	}
+	return b.withMeta(objectInfoFromHeader(bucket, object, headFile.Data.Header)), nil
+}
+
+func (b *OpenApiBackend) DeleteObject(ctx context.Context, bucket, object string) *APIError {
+	if s3Err := DelFile(ctx, bucket, object); s3Err != nil {
+		return s3Err
+	}
+	if err := b.meta.Delete(bucket, object); err != nil {
+		logger.Error("delete object %s/%s metadata error:%s", bucket, object, err.Error())
+	}
+	return nil
+}
+
+//CopyObject open api 没有按 cid 创建对象的接口, 按源对象的 cid 下载后重新上传
+func (b *OpenApiBackend) CopyObject(ctx context.Context, srcBucket, srcObject, dstBucket, dstObject string, opts ObjectOptions) (ObjectInfo, *APIError) {
+	if _, s3Err := copyObjectByStream(ctx, b, srcBucket, srcObject, dstBucket, dstObject, opts); s3Err != nil {
+		return ObjectInfo{}, s3Err
+	}
+	return b.HeadObject(ctx, dstBucket, dstObject)
+}
+
+func (*OpenApiBackend) ListObjects(ctx context.Context, bucket, prefix string) ([]ObjectInfo, *APIError) {
+	out, s3Err := ListFile(ctx, bucket, prefix)
+	if s3Err != nil {
+		return nil, s3Err
+	}
+	result := mxml.ListObjectResult{}
+	decoder := xml.NewDecoder(strings.NewReader(out.Data.Data))
+	if err := decoder.Decode(&result); err != nil {
+		return nil, errorCodes.ToAPIErr(ErrMalformedXML)
+	}
+	objects := make([]ObjectInfo, 0, len(result.Contents))
+	for _, c := range result.Contents {
+		//存储节点可能忽略 prefix, 这里再过滤一次
+		if !strings.HasPrefix(c.Key, prefix) {
+			continue
+		}
+		objects = append(objects, ObjectInfo{
+			Bucket:       bucket,
+			Name:         c.Key,
+			Size:         int64(c.Size),
+			ETag:         strings.Trim(c.ETag, "\""),
+			ModTime:      c.LastModified,
+			StorageClass: c.StorageClass,
+		})
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Name < objects[j].Name
+	})
+	return objects, nil
+}
+
+//objectInfoFromHeader 存储节点返回的响应头转换为对象信息, 只保留随对象保存的元数据
+func objectInfoFromHeader(bucket, object string, header map[string]string) ObjectInfo {
+	//没有 Content-Length 时大小未知
+	objInfo := ObjectInfo{
+		Bucket:       bucket,
+		Name:         object,
+		Size:         -1,
+		StorageClass: "STANDARD",
+	}
+	h := make(http.Header, len(header))
+	for k, v := range header {
+		switch http.CanonicalHeaderKey(k) {
+		case "Content-Length":
+			objInfo.Size, _ = strconv.ParseInt(v, 10, 64)
+		case "Etag":
+			objInfo.ETag = strings.Trim(v, "\"")
+		case "Content-Type":
+			objInfo.ContentType = v
+		case "Last-Modified":
+			objInfo.ModTime, _ = time.Parse(http.TimeFormat, v)
+		case "X-Amz-Storage-Class":
+			objInfo.StorageClass = v
+		}
+		h.Set(k, v)
+	}
+	objInfo.UserDefined = filterMetadata(h)
+	delete(objInfo.UserDefined, xhttp.ContentType)
+	return objInfo
+}
+
+//withMeta 使用网关保存的元数据, 对象大小与记录不一致(被其他途径覆盖)时忽略记录
+func (b *OpenApiBackend) withMeta(objInfo ObjectInfo) ObjectInfo {
+	meta, ok, err := b.meta.Get(objInfo.Bucket, objInfo.Name)
+	if err != nil {
+		logger.Error("read object %s/%s metadata error:%s", objInfo.Bucket, objInfo.Name, err.Error())
+		return objInfo
+	}
+	if !ok || (objInfo.Size >= 0 && objInfo.Size != meta.Size) {
+		return objInfo
+	}
+	if meta.ETag != "" {
+		objInfo.ETag = meta.ETag
+	}
+	objInfo.Parts = meta.Parts
+	objInfo.UserDefined = make(map[string]string, len(meta.UserDefined))
+	for k, v := range meta.UserDefined {
+		switch k {
+		case xhttp.ContentType:
+			objInfo.ContentType = v
+			continue
+		case "X-Amz-Storage-Class":
+			objInfo.StorageClass = v
+		}
+		objInfo.UserDefined[k] = v
+	}
+	return objInfo
+}
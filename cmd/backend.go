@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+//存储后端抽象, s3 handler 只依赖该接口
+
+// BucketInfo 桶信息
+type BucketInfo struct {
+	Name    string
+	Created time.Time
+	// Location 创建桶时的 LocationConstraint
+	Location string
+}
+
+// ObjectInfo 对象信息
+type ObjectInfo struct {
+	Bucket       string
+	Name         string
+	Size         int64
+	ETag         string
+	ContentType  string
+	ModTime      time.Time
+	StorageClass string
+	// UserDefined 需要原样返回给客户端的响应头
+	UserDefined map[string]string
+	// Parts 分片上传合并的对象记录各分片大小, 用于 partNumber 读取
+	Parts []ObjectPartInfo
+}
+
+// ObjectPartInfo 分片信息
+type ObjectPartInfo struct {
+	Number int   `json:"number"`
+	Size   int64 `json:"size"`
+}
+
+// ObjectOptions 上传对象时的附加信息
+type ObjectOptions struct {
+	// UserDefined Content-Type 及 x-amz-meta-* 等需要保存的元数据
+	UserDefined map[string]string
+	// ETag 不为空时作为对象的 ETag 保存, 分片上传合并时使用
+	ETag string
+	// Parts 分片上传合并时的分片信息
+	Parts []ObjectPartInfo
+}
+
+// Backend 存储后端
+type Backend interface {
+	// UserSecret 根据 ak 查询 sk
+	UserSecret(accessKey string) (string, error)
+
+	// CreateBucket location 为桶所在区域, 由 GetBucketInfo 返回
+	CreateBucket(ctx context.Context, bucket, location string) *APIError
+	HeadBucket(ctx context.Context, bucket string) *APIError
+	GetBucketInfo(ctx context.Context, bucket string) (BucketInfo, *APIError)
+	DeleteBucket(ctx context.Context, bucket string) *APIError
+	ListBuckets(ctx context.Context) ([]BucketInfo, *APIError)
+
+	PutObject(ctx context.Context, bucket, object string, data io.Reader, size int64, opts ObjectOptions) (ObjectInfo, *APIError)
+	// GetObject 从 offset 开始读取 length 字节, length < 0 时读取到末尾
+	GetObject(ctx context.Context, bucket, object string, offset, length int64) (io.ReadCloser, ObjectInfo, *APIError)
+	HeadObject(ctx context.Context, bucket, object string) (ObjectInfo, *APIError)
+	DeleteObject(ctx context.Context, bucket, object string) *APIError
+	// CopyObject 服务端复制对象, opts 为目标对象的元数据
+	CopyObject(ctx context.Context, srcBucket, srcObject, dstBucket, dstObject string, opts ObjectOptions) (ObjectInfo, *APIError)
+	// ListObjects 按 key 升序返回以 prefix 开头的全部对象, 分页及 delimiter 由网关处理
+	ListObjects(ctx context.Context, bucket, prefix string) ([]ObjectInfo, *APIError)
+}
+
+// GlobalBackend 签名校验时查询 sk 使用
+var GlobalBackend Backend
+
+//copyObjectByStream 后端不支持服务端复制时, 读取源对象后重新上传
+func copyObjectByStream(ctx context.Context, b Backend, srcBucket, srcObject, dstBucket, dstObject string, opts ObjectOptions) (ObjectInfo, *APIError) {
+	reader, srcInfo, s3Err := b.GetObject(ctx, srcBucket, srcObject, 0, -1)
+	if s3Err != nil {
+		return ObjectInfo{}, s3Err
+	}
+	defer reader.Close()
+	//存储节点以 chunked 返回时大小未知, 上传需要准确的大小, 通过 HeadObject 获取
+	size := srcInfo.Size
+	if size < 0 {
+		headInfo, s3Err := b.HeadObject(ctx, srcBucket, srcObject)
+		if s3Err != nil {
+			return ObjectInfo{}, s3Err
+		}
+		if headInfo.Size < 0 {
+			return ObjectInfo{}, errorCodes.ToAPIErr(ErrInternalError)
+		}
+		size = headInfo.Size
+	}
+	return b.PutObject(ctx, dstBucket, dstObject, reader, size, opts)
+}
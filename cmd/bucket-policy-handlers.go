@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/minio/minio-go/v7/pkg/s3utils"
+	"github.com/minio/pkg/bucket/policy"
+	"s3Gateway/internal/logger"
+)
+
+//PutPolicy PUT /{bucket}?policy
+func (b *Bucket) PutPolicy(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiPutBucketPolicy)
+	params := mux.Vars(r)
+	cred, s3Error := checkRequestAuthType(ctx, r, apiActions[apiPutBucketPolicy], params["bucket"], "")
+	if s3Error != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if err := SetKey(ctx, cred); err != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if s3utils.CheckValidBucketName(params["bucket"]) != nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrInvalidBucketName), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if r.ContentLength <= 0 {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrMissingContentLength), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if r.ContentLength > maxBucketPolicySize {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrPolicyTooLarge), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, r.ContentLength))
+	if err != nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(toAPIErrorCode(ctx, err)), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	bucketPolicy, err := policy.ParseConfig(bytes.NewReader(body), params["bucket"])
+	if err != nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErrWithErr(ErrMalformedPolicy, err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if bucketPolicy.Version == "" || bucketPolicy.IsEmpty() {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrMalformedPolicy), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	//确认桶存在且调用者可以访问
+	if s3Err := b.Backend.HeadBucket(ctx, params["bucket"]); s3Err != nil {
+		WriteErrorResponse(ctx, w, s3Err, r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if err := b.Policy.Set(params["bucket"], body, bucketPolicy); err != nil {
+		if errors.Is(err, errNoBucketOwner) {
+			WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrAccessDenied), r.URL, guessIsBrowserReq(r))
+			return
+		}
+		logger.Error("save bucket %s policy error:%s", params["bucket"], err.Error())
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrInternalError), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	WriteSuccessNoContent(w)
+}
+
+//GetPolicy GET /{bucket}?policy
+func (b *Bucket) GetPolicy(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiGetBucketPolicy)
+	params := mux.Vars(r)
+	if cred, s3Error := checkRequestAuthType(ctx, r, apiActions[apiGetBucketPolicy], params["bucket"], ""); s3Error != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
+		return
+	} else {
+		if err := SetKey(ctx, cred); err != ErrNone {
+			WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(err), r.URL, guessIsBrowserReq(r))
+			return
+		}
+	}
+	if s3Err := b.Backend.HeadBucket(ctx, params["bucket"]); s3Err != nil {
+		WriteErrorResponse(ctx, w, s3Err, r.URL, guessIsBrowserReq(r))
+		return
+	}
+	bp, ok := b.Policy.Get(params["bucket"])
+	if !ok {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrNoSuchBucketPolicy), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	WriteResponse(w, http.StatusOK, bp.Policy, mimeJSON)
+}
+
+//DeletePolicy DELETE /{bucket}?policy
+func (b *Bucket) DeletePolicy(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiDeleteBucketPolicy)
+	params := mux.Vars(r)
+	if cred, s3Error := checkRequestAuthType(ctx, r, apiActions[apiDeleteBucketPolicy], params["bucket"], ""); s3Error != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
+		return
+	} else {
+		if err := SetKey(ctx, cred); err != ErrNone {
+			WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(err), r.URL, guessIsBrowserReq(r))
+			return
+		}
+	}
+	if s3Err := b.Backend.HeadBucket(ctx, params["bucket"]); s3Err != nil {
+		WriteErrorResponse(ctx, w, s3Err, r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if err := b.Policy.Delete(params["bucket"]); err != nil {
+		logger.Error("delete bucket %s policy error:%s", params["bucket"], err.Error())
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrInternalError), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	WriteSuccessNoContent(w)
+}
@@ -0,0 +1,299 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/pkg/bucket/policy"
+	"s3Gateway/internal/auth"
+)
+
+//桶策略, 保存在网关本地 <dir>/<bucket>.json, 桶的所有者保存在 <dir>/owners/<bucket>.owner
+//匿名请求只有桶策略允许时才能访问, 访问存储后端时使用桶所有者 (owner) 的身份
+//owner 为通过网关创建桶的 ak, 设置策略不会改变 owner; 不是通过网关创建的桶没有 owner, 不能设置策略
+//桶策略及 owner 按桶名保存, 网关的桶名是全局的: 桶名已有 owner 时其他 ak 不能再通过网关创建同名桶
+
+const (
+	// maxBucketPolicySize 桶策略大小上限, 与 s3 一致为 20KiB
+	maxBucketPolicySize = 20 * 1024
+	// bucketOwnerDir 保存桶 owner 的子目录
+	bucketOwnerDir = "owners"
+)
+
+// bucketPolicy 桶策略及其所有者
+type bucketPolicy struct {
+	Owner  string          `json:"owner"`
+	Policy json.RawMessage `json:"policy"`
+	parsed *policy.Policy
+}
+
+// BucketPolicyStore 桶策略存储, 启动时全部加载到内存
+type BucketPolicyStore struct {
+	dir      string
+	mu       sync.RWMutex
+	policies map[string]bucketPolicy
+	owners   map[string]string
+}
+
+// GlobalBucketPolicyStore 鉴权时使用, main 中初始化
+var GlobalBucketPolicyStore *BucketPolicyStore
+
+func NewBucketPolicyStore(dir string) (*BucketPolicyStore, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, bucketOwnerDir), 0755); err != nil {
+		return nil, err
+	}
+	s := &BucketPolicyStore{dir: dir, policies: make(map[string]bucketPolicy), owners: make(map[string]string)}
+	entries, err := ioutil.ReadDir(filepath.Join(dir, bucketOwnerDir))
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".owner") {
+			continue
+		}
+		buf, err := ioutil.ReadFile(filepath.Join(dir, bucketOwnerDir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		s.owners[strings.TrimSuffix(entry.Name(), ".owner")] = strings.TrimSpace(string(buf))
+	}
+	if entries, err = ioutil.ReadDir(dir); err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		bucket := strings.TrimSuffix(entry.Name(), ".json")
+		buf, err := ioutil.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		bp := bucketPolicy{}
+		if err := json.Unmarshal(buf, &bp); err != nil {
+			return nil, errors.New("corrupted bucket policy " + bucket)
+		}
+		if bp.parsed, err = policy.ParseConfig(strings.NewReader(string(bp.Policy)), bucket); err != nil {
+			return nil, errors.New("invalid bucket policy " + bucket + ": " + err.Error())
+		}
+		//记录 owner 之前保存的策略, 以策略中的 owner 为准
+		if _, ok := s.owners[bucket]; !ok && bp.Owner != "" {
+			if err := s.SetOwner(bucket, bp.Owner); err != nil {
+				return nil, err
+			}
+		}
+		bp.Owner = s.owners[bucket]
+		s.policies[bucket] = bp
+	}
+	return s, nil
+}
+
+//Get 返回桶策略
+func (s *BucketPolicyStore) Get(bucket string) (bucketPolicy, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	bp, ok := s.policies[bucket]
+	return bp, ok
+}
+
+//Owner 返回桶的 owner
+func (s *BucketPolicyStore) Owner(bucket string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	owner, ok := s.owners[bucket]
+	return owner, ok
+}
+
+//SetOwner 记录桶的 owner, 创建桶成功后调用
+func (s *BucketPolicyStore) SetOwner(bucket, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := writeFileAtomic(filepath.Join(s.dir, bucketOwnerDir, bucket+".owner"), []byte(owner)); err != nil {
+		return err
+	}
+	s.owners[bucket] = owner
+	return nil
+}
+
+//Set 保存桶策略, raw 为客户端上传的原始策略, 已由 policy.ParseConfig 校验
+//策略的 owner 为桶的 owner, 桶没有 owner 时返回 errNoBucketOwner
+func (s *BucketPolicyStore) Set(bucket string, raw []byte, p *policy.Policy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	owner, ok := s.owners[bucket]
+	if !ok {
+		return errNoBucketOwner
+	}
+	bp := bucketPolicy{Owner: owner, Policy: raw, parsed: p}
+	buf, err := json.Marshal(bp)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(s.dir, bucket+".json"), buf); err != nil {
+		return err
+	}
+	s.policies[bucket] = bp
+	return nil
+}
+
+//Delete 删除桶策略, 策略不存在时不报错
+func (s *BucketPolicyStore) Delete(bucket string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(filepath.Join(s.dir, bucket+".json")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(s.policies, bucket)
+	return nil
+}
+
+//DeleteBucket 删除桶后调用, 删除桶策略及 owner
+func (s *BucketPolicyStore) DeleteBucket(bucket string) error {
+	if err := s.Delete(bucket); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(filepath.Join(s.dir, bucketOwnerDir, bucket+".owner")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(s.owners, bucket)
+	return nil
+}
+
+//writeFileAtomic 先写临时文件再重命名
+func writeFileAtomic(name string, buf []byte) error {
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+//isBucketPolicyAction 管理桶策略的操作, 非 owner 必须由策略明确允许
+func isBucketPolicyAction(action policy.Action) bool {
+	switch action {
+	case policy.PutBucketPolicyAction, policy.GetBucketPolicyAction, policy.DeleteBucketPolicyAction:
+		return true
+	}
+	return false
+}
+
+//checkBucketPolicy 按桶策略鉴权
+//  - 没有桶策略: 拒绝匿名请求, 管理桶策略只允许 owner, 其他已认证请求交给存储后端鉴权
+//  - owner: 允许
+//  - 其他已认证请求: 命中 Deny 时拒绝, 管理桶策略需要 Allow
+//  - 匿名请求: 需要 Allow, 返回 owner 的身份用于访问存储后端
+func checkBucketPolicy(r *http.Request, action policy.Action, bucketName, objectName string, cred auth.Credentials) (auth.Credentials, APIErrorCode) {
+	anonymous := cred.AccessKey == ""
+	bp, ok := GlobalBucketPolicyStore.Get(bucketName)
+	if !ok || bucketName == "" {
+		if anonymous {
+			return cred, ErrAccessDenied
+		}
+		//还没有策略时只有 owner 可以设置
+		if isBucketPolicyAction(action) {
+			if owner, ok := GlobalBucketPolicyStore.Owner(bucketName); !ok || owner != cred.AccessKey {
+				return cred, ErrAccessDenied
+			}
+		}
+		return cred, ErrNone
+	}
+	if !anonymous && cred.AccessKey == bp.Owner {
+		return cred, ErrNone
+	}
+	args := policy.Args{
+		AccountName:     cred.AccessKey,
+		Action:          action,
+		BucketName:      bucketName,
+		ObjectName:      objectName,
+		ConditionValues: getConditionValues(r, cred),
+		IsOwner:         !anonymous && !isBucketPolicyAction(action),
+	}
+	if !bp.parsed.IsAllowed(args) {
+		return cred, ErrAccessDenied
+	}
+	if !anonymous {
+		return cred, ErrNone
+	}
+	secretKey, err := GlobalCredentialCache.Get(bp.Owner)
+	if err != nil {
+		if errors.Is(err, errNoSuchUser) {
+			return cred, ErrAccessDenied
+		}
+		return cred, ErrBusy
+	}
+	return auth.Credentials{AccessKey: bp.Owner, SecretKey: secretKey}, ErrNone
+}
+
+//isAllowedByBucketPolicy 桶策略是否明确允许该请求, IAM 策略未允许时使用
+func isAllowedByBucketPolicy(r *http.Request, action policy.Action, bucketName, objectName string, cred auth.Credentials) bool {
+	bp, ok := GlobalBucketPolicyStore.Get(bucketName)
+	if !ok || bucketName == "" {
+		return false
+	}
+	return bp.parsed.IsAllowed(policy.Args{
+		AccountName:     cred.AccessKey,
+		Action:          action,
+		BucketName:      bucketName,
+		ObjectName:      objectName,
+		ConditionValues: getConditionValues(r, cred),
+	})
+}
+
+//getConditionValues 策略 Condition 使用的变量, 包括请求头及查询参数
+func getConditionValues(r *http.Request, cred auth.Credentials) map[string][]string {
+	currTime := time.Now().UTC()
+	principalType := "Anonymous"
+	if cred.AccessKey != "" {
+		principalType = "User"
+	}
+	args := map[string][]string{
+		"CurrentTime":     {currTime.Format(time.RFC3339)},
+		"EpochTime":       {strconv.FormatInt(currTime.Unix(), 10)},
+		"SecureTransport": {strconv.FormatBool(r.TLS != nil)},
+		"SourceIp":        {getSourceIP(r)},
+		"UserAgent":       {r.UserAgent()},
+		"Referer":         {r.Referer()},
+		"principaltype":   {principalType},
+		"userid":          {cred.AccessKey},
+		"username":        {cred.AccessKey},
+	}
+	for key, values := range r.Header {
+		if _, found := args[key]; !found {
+			args[key] = values
+		}
+	}
+	for key, values := range r.URL.Query() {
+		if _, found := args[key]; !found {
+			args[key] = values
+		}
+	}
+	return args
+}
+
+//getSourceIP 客户端地址, 不信任可被伪造的 X-Forwarded-For
+func getSourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
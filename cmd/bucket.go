@@ -3,40 +3,66 @@ package cmd
 import (
 	"encoding/xml"
 	"github.com/gorilla/mux"
-	"github.com/minio/pkg/bucket/policy"
-	"log"
+	"io"
 	"net/http"
+	xhttp "s3Gateway/internal/http"
+	"s3Gateway/internal/logger"
 	mxml "s3Gateway/model/xml"
-	"strings"
+	"s3Gateway/model/yml"
 )
 
-type Bucket struct{}
+// maxLocationConstraintSize CreateBucketConfiguration 请求体上限
+const maxLocationConstraintSize = 3 * 1024 * 1024
 
-func (*Bucket) Create(w http.ResponseWriter, r *http.Request) {
-	ctx := newContext(r, w, "create-Bucket")
+type Bucket struct {
+	Backend Backend
+	Policy  *BucketPolicyStore
+}
+
+func (b *Bucket) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiCreateBucket)
 	params := mux.Vars(r)
-	if cred, s3Error := checkRequestAuthType(ctx, r, policy.CreateBucketAction, params["bucket"], ""); s3Error != ErrNone {
+	cred, s3Error := checkRequestAuthType(ctx, r, apiActions[apiCreateBucket], params["bucket"], "")
+	if s3Error != ErrNone {
 		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
 		return
-	} else {
-		if err := SetKey(ctx, cred); err != ErrNone {
-			WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(err), r.URL, guessIsBrowserReq(r))
-			return
-		}
 	}
-	s3Err := CreateBucket(ctx)
+	if err := SetKey(ctx, cred); err != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	location, s3Error := parseLocationConstraint(r)
+	if s3Error != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	//与网关自身接口的路径前缀同名的桶无法通过路径风格访问
+	if SlashSeparator+params["bucket"] == GatewayPathPrefix {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrInvalidBucketName), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	//桶名已属于其他 ak 时不能创建, 避免不同租户的同名桶共用桶策略
+	if owner, ok := b.Policy.Owner(params["bucket"]); ok && owner != cred.AccessKey {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrBucketAlreadyExists), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	s3Err := b.Backend.CreateBucket(ctx, params["bucket"], location)
 	if s3Err != nil {
 		WriteErrorResponse(ctx, w, s3Err, r.URL, guessIsBrowserReq(r))
 		return
 	}
+	if cred.AccessKey != "" {
+		if err := b.Policy.SetOwner(params["bucket"], cred.AccessKey); err != nil {
+			logger.Error("save bucket %s owner error:%s", params["bucket"], err.Error())
+		}
+	}
 	WriteSuccessResponseHeadersOnly(w)
 }
 
-func (*Bucket) Head(w http.ResponseWriter, r *http.Request) {
-	ctx := newContext(r, w, "head-Bucket")
+func (b *Bucket) Head(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiHeadBucket)
 	params := mux.Vars(r)
-	log.Println(params)
-	if cred, s3Error := checkRequestAuthType(ctx, r, policy.CreateBucketAction, params["bucket"], ""); s3Error != ErrNone {
+	if cred, s3Error := checkRequestAuthType(ctx, r, apiActions[apiHeadBucket], params["bucket"], ""); s3Error != ErrNone {
 		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
 		return
 	} else {
@@ -45,18 +71,19 @@ func (*Bucket) Head(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
-	if s3err := HeadBucket(ctx); s3err != nil {
+	info, s3err := b.Backend.GetBucketInfo(ctx, params["bucket"])
+	if s3err != nil {
 		WriteErrorResponse(ctx, w, s3err, r.URL, guessIsBrowserReq(r))
 		return
 	}
+	w.Header().Set(xhttp.AmzBucketRegion, bucketLocation(info))
 	WriteSuccessResponseHeadersOnly(w)
 }
 
-func (*Bucket) Delete(w http.ResponseWriter, r *http.Request) {
-	ctx := newContext(r, w, "delete-Bucket")
+func (b *Bucket) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiDeleteBucket)
 	params := mux.Vars(r)
-	log.Println(params)
-	if cred, s3Error := checkRequestAuthType(ctx, r, policy.CreateBucketAction, params["bucket"], ""); s3Error != ErrNone {
+	if cred, s3Error := checkRequestAuthType(ctx, r, apiActions[apiDeleteBucket], params["bucket"], ""); s3Error != ErrNone {
 		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
 		return
 	} else {
@@ -65,43 +92,47 @@ func (*Bucket) Delete(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
-	if s3err := DelBucket(ctx); s3err != nil {
+	if s3err := b.Backend.DeleteBucket(ctx, params["bucket"]); s3err != nil {
 		WriteErrorResponse(ctx, w, s3err, r.URL, guessIsBrowserReq(r))
 		return
 	}
+	if err := b.Policy.DeleteBucket(params["bucket"]); err != nil {
+		logger.Error("delete bucket %s policy error:%s", params["bucket"], err.Error())
+	}
 	WriteSuccessNoContent(w)
 }
-func (*Bucket) List(w http.ResponseWriter, r *http.Request) {
-	ctx := newContext(r, w, "list-Bucket")
+func (b *Bucket) List(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiListBuckets)
 	params := mux.Vars(r)
-	log.Println(params)
-	if cred, s3Error := checkRequestAuthType(ctx, r, policy.CreateBucketAction, params["bucket"], ""); s3Error != ErrNone {
+	cred, s3Error := checkRequestAuthType(ctx, r, apiActions[apiListBuckets], params["bucket"], "")
+	if s3Error != ErrNone {
 		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
 		return
-	} else {
-		if err := SetKey(ctx, cred); err != ErrNone {
-			WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(err), r.URL, guessIsBrowserReq(r))
-			return
-		}
 	}
-	out, s3err := ListBucket(ctx)
+	if err := SetKey(ctx, cred); err != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	bucketsInfo, s3err := b.Backend.ListBuckets(ctx)
 	if s3err != nil {
 		WriteErrorResponse(ctx, w, s3err, r.URL, guessIsBrowserReq(r))
 		return
 	}
-	buckets := mxml.ListBucket{}
-	decoder := xml.NewDecoder(strings.NewReader(out.Data.Data))
-	if err := decoder.Decode(&buckets); err != nil {
-		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrMalformedXML), r.URL, guessIsBrowserReq(r))
-		return
+	buckets := mxml.ListBucket{
+		Owner: mxml.Owner{Id: cred.AccessKey, DisplayName: cred.AccessKey},
+	}
+	for _, bucket := range bucketsInfo {
+		buckets.Buckets.Bucket = append(buckets.Buckets.Bucket, mxml.Bucket{
+			Name:         bucket.Name,
+			CreationDate: bucket.Created.UTC(),
+		})
 	}
 	WriteSuccessResponseXML(w, EncodeResponse(buckets))
 }
-func (*Bucket) Location(w http.ResponseWriter, r *http.Request) {
-	ctx := newContext(r, w, "location-Bucket")
+func (b *Bucket) Location(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiGetBucketLocation)
 	params := mux.Vars(r)
-	log.Println(params)
-	if cred, s3Error := checkRequestAuthType(ctx, r, policy.CreateBucketAction, params["bucket"], ""); s3Error != ErrNone {
+	if cred, s3Error := checkRequestAuthType(ctx, r, apiActions[apiGetBucketLocation], params["bucket"], ""); s3Error != ErrNone {
 		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
 		return
 	} else {
@@ -110,9 +141,39 @@ func (*Bucket) Location(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
-	body := mxml.CreateBucket{
-		XMLName:  xml.Name{Local: "LocationConstraint"},
-		Location: "ap-east-1",
+	info, s3err := b.Backend.GetBucketInfo(ctx, params["bucket"])
+	if s3err != nil {
+		WriteErrorResponse(ctx, w, s3err, r.URL, guessIsBrowserReq(r))
+		return
+	}
+	body := mxml.LocationConstraint{Xmlns: s3Namespace}
+	//与 s3 一致, us-east-1 返回空的 LocationConstraint
+	if location := bucketLocation(info); location != yml.DefaultRegion {
+		body.Location = location
 	}
 	WriteSuccessResponseXML(w, EncodeResponse(body))
 }
+
+//parseLocationConstraint 解析 CreateBucketConfiguration, 未指定时使用网关区域
+func parseLocationConstraint(r *http.Request) (string, APIErrorCode) {
+	config := mxml.CreateBucket{}
+	err := xml.NewDecoder(io.LimitReader(r.Body, maxLocationConstraintSize)).Decode(&config)
+	if err != nil && err != io.EOF {
+		return "", ErrMalformedXML
+	}
+	if config.Location == "" {
+		return serverRegion(), ErrNone
+	}
+	if config.Location != serverRegion() {
+		return "", ErrInvalidRegion
+	}
+	return config.Location, ErrNone
+}
+
+//bucketLocation 返回桶所在区域, 未记录区域的桶属于网关区域
+func bucketLocation(info BucketInfo) string {
+	if info.Location == "" {
+		return serverRegion()
+	}
+	return info.Location
+}
@@ -2,14 +2,21 @@ package cmd
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"github.com/gorilla/mux"
+	"github.com/minio/pkg/bucket/policy"
+	"io"
 	"net/http"
 	"net/url"
+	"os"
 	"path"
+	"runtime/debug"
 	"s3Gateway/internal/auth"
 	xhttp "s3Gateway/internal/http"
 	"s3Gateway/internal/logger"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -70,17 +77,32 @@ func likelyUnescapeGeneric(p string, escapeFn func(string) (string, error)) stri
 }
 
 type ReqInfo struct {
+	// BackendLatency 请求 openApi 的累计耗时(纳秒), 位于首位保证原子操作的 64 位对齐
+	BackendLatency int64
+
 	Writer     http.ResponseWriter
 	Request    *http.Request
-	RequestID  string // x-amz-request-id
-	API        string // API name - GetObject PutObject NewMultipartUpload etc.
-	BucketName string // Bucket name
-	ObjectName string // Object name
-	AccessKey  string // Access Key
-	SecretKey  string // secret Key
+	RequestID  string        // x-amz-request-id
+	API        string        // API name - GetObject PutObject NewMultipartUpload etc.
+	Action     policy.Action // policy action used for authorization
+	BucketName string        // Bucket name
+	ObjectName string        // Object name
+	AccessKey  string        // Access Key
+	SecretKey  string        // secret Key
+	ErrorCode  string        // error code of the response, empty on success
+}
+
+//addBackendLatency 累加请求后端的耗时
+func (r *ReqInfo) addBackendLatency(d time.Duration) {
+	atomic.AddInt64(&r.BackendLatency, int64(d))
+}
+
+func (r *ReqInfo) backendLatency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&r.BackendLatency))
 }
 
 // Returns context with ReqInfo details set in the context.
+// The ReqInfo created by AccessLog is reused so that it can log the API details.
 func newContext(r *http.Request, w http.ResponseWriter, api string) context.Context {
 	vars := mux.Vars(r)
 	bucket := vars["bucket"]
@@ -89,15 +111,20 @@ func newContext(r *http.Request, w http.ResponseWriter, api string) context.Cont
 	if prefix != "" {
 		object = prefix
 	}
-	reqInfo := &ReqInfo{
-		Writer:     w,
-		Request:    r,
-		RequestID:  w.Header().Get(xhttp.AmzRequestID),
-		API:        api,
-		BucketName: bucket,
-		ObjectName: object,
+	ctx := r.Context()
+	reqInfo, ok := GetReqInfo(ctx)
+	if !ok {
+		reqInfo = &ReqInfo{}
+		ctx = context.WithValue(ctx, requestInfo, reqInfo)
 	}
-	return context.WithValue(r.Context(), requestInfo, reqInfo)
+	reqInfo.Writer = w
+	reqInfo.Request = r
+	reqInfo.RequestID = w.Header().Get(xhttp.AmzRequestID)
+	reqInfo.API = api
+	reqInfo.Action = apiActions[api]
+	reqInfo.BucketName = bucket
+	reqInfo.ObjectName = object
+	return ctx
 }
 func GetReqInfo(ctx context.Context) (*ReqInfo, bool) {
 	v, ok := ctx.Value(requestInfo).(*ReqInfo)
@@ -116,6 +143,8 @@ func SetKey(ctx context.Context, cred auth.Credentials) APIErrorCode {
 type ResponseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	// bytesWritten 响应体字节数
+	bytesWritten int64
 }
 
 func (w *ResponseWriter) WriteHeader(statusCode int) {
@@ -123,25 +152,95 @@ func (w *ResponseWriter) WriteHeader(statusCode int) {
 	w.ResponseWriter.WriteHeader(statusCode)
 }
 
-//AccessLog 记录访问日志
+func (w *ResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.bytesWritten += int64(n)
+	return n, err
+}
+
+// countingReadCloser 统计读取的请求体字节数
+type countingReadCloser struct {
+	io.ReadCloser
+	bytesRead int64
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.bytesRead += int64(n)
+	return n, err
+}
+
+// globalHostID 网关节点标识(主机名的 sha256), 作为 x-amz-id-2 返回
+var globalHostID = func() string {
+	name, err := os.Hostname()
+	if err != nil {
+		name = "s3gateway"
+	}
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:])
+}()
+
+//SetRequestIDHandler 为每个请求生成唯一 id, 写入 x-amz-request-id 及 x-amz-id-2 响应头
+//需位于其他中间件之前, 使其返回的错误同样携带 request id
+func SetRequestIDHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID, err := GenerateUUID()
+		if err != nil {
+			logger.Error("generate request id error:%s", err.Error())
+		}
+		w.Header().Set(xhttp.AmzRequestID, requestID)
+		w.Header().Set(xhttp.AmzRequestHostID, globalHostID)
+		h.ServeHTTP(w, r)
+	})
+}
+
+//AccessLog 记录访问日志, 每个请求一条结构化日志
 func AccessLog(h http.Handler) http.Handler {
+	accessLogger := logger.Named("access")
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		wc := &ResponseWriter{
 			statusCode:     http.StatusOK,
 			ResponseWriter: w,
 		}
-		for key, values := range r.Header {
-			logger.Debug("header key=>%s,value=>%s", key, strings.Join(values, ";"))
-		}
+		reqInfo := &ReqInfo{RequestID: w.Header().Get(xhttp.AmzRequestID)}
+		anonymous := getRequestAuthType(r) == authTypeAnonymous
+		body := &countingReadCloser{ReadCloser: r.Body}
+		r.Body = body
+		accessLogger.WithFields(logger.Fields{"request_id": reqInfo.RequestID, "headers": r.Header}).Debug("request headers")
+		httpRequestsInFlight.Inc()
 
 		defer func() {
-			logger.Info("url path %s,time %s,response status code %d", r.URL.Path, time.Since(start), wc.statusCode)
 			if err := recover(); err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				return
+				logger.WithFields(logger.Fields{"request_id": reqInfo.RequestID, "stack": string(debug.Stack())}).Error("panic: %v", err)
+				wc.WriteHeader(http.StatusInternalServerError)
+			}
+			httpRequestsInFlight.Dec()
+			duration := time.Since(start)
+			recordRequestMetrics(reqInfo.API, wc.statusCode, duration, body.bytesRead, wc.bytesWritten)
+			accessKey := reqInfo.AccessKey
+			if anonymous {
+				//匿名请求使用桶策略 owner 的身份访问后端, 日志中记录为 anonymous
+				accessKey = "anonymous"
 			}
+			accessLogger.WithFields(logger.Fields{
+				"request_id":  reqInfo.RequestID,
+				"api":         reqInfo.API,
+				"action":      string(reqInfo.Action),
+				"bucket":      reqInfo.BucketName,
+				"object":      reqInfo.ObjectName,
+				"access_key":  accessKey,
+				"method":      r.Method,
+				"path":        r.URL.Path,
+				"remote":      r.RemoteAddr,
+				"status":      wc.statusCode,
+				"bytes_in":    body.bytesRead,
+				"bytes_out":   wc.bytesWritten,
+				"duration_ms": duration,
+				"backend_ms":  reqInfo.backendLatency(),
+				"error_code":  reqInfo.ErrorCode,
+			}).Info("request")
 		}()
-		h.ServeHTTP(wc, r)
+		h.ServeHTTP(wc, r.WithContext(context.WithValue(r.Context(), requestInfo, reqInfo)))
 	})
 }
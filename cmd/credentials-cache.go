@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"s3Gateway/internal/logger"
+)
+
+//ak -> sk 查询缓存, 避免每个请求都访问 secret_by_appid
+
+const (
+	defaultCredentialTTL         = 5 * time.Minute
+	defaultCredentialNegativeTTL = 30 * time.Second
+	// maxCredentialEntries 缓存条目上限, 防止大量随机 ak 占满内存
+	maxCredentialEntries = 10000
+)
+
+// credentialEntry 缓存条目, err 不为空时为未知 ak 的负缓存
+type credentialEntry struct {
+	secretKey string
+	err       error
+	expires   time.Time
+}
+
+// credentialCall 正在进行的查询, 同一 ak 的并发查询共用一次结果
+type credentialCall struct {
+	wg        sync.WaitGroup
+	secretKey string
+	err       error
+}
+
+// CredentialCache ak -> sk 缓存
+type CredentialCache struct {
+	mu          sync.Mutex
+	ttl         time.Duration
+	negativeTTL time.Duration
+	entries     map[string]credentialEntry
+	calls       map[string]*credentialCall
+	lookup      func(accessKey string) (string, error)
+}
+
+// GlobalCredentialCache 签名校验时使用, main 中初始化
+var GlobalCredentialCache *CredentialCache
+
+//NewCredentialCache ttl 为查询成功的缓存时间, negativeTTL 为未知 ak 的缓存时间, 小于等于 0 时使用默认值
+func NewCredentialCache(lookup func(accessKey string) (string, error), ttl, negativeTTL time.Duration) *CredentialCache {
+	if ttl <= 0 {
+		ttl = defaultCredentialTTL
+	}
+	if negativeTTL <= 0 {
+		negativeTTL = defaultCredentialNegativeTTL
+	}
+	return &CredentialCache{
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		entries:     make(map[string]credentialEntry),
+		calls:       make(map[string]*credentialCall),
+		lookup:      lookup,
+	}
+}
+
+//Get 返回 ak 对应的 sk, 缓存未命中时查询存储后端
+func (c *CredentialCache) Get(accessKey string) (string, error) {
+	c.mu.Lock()
+	if entry, ok := c.entries[accessKey]; ok && time.Now().Before(entry.expires) {
+		c.mu.Unlock()
+		return entry.secretKey, entry.err
+	}
+	if call, ok := c.calls[accessKey]; ok {
+		c.mu.Unlock()
+		call.wg.Wait()
+		return call.secretKey, call.err
+	}
+	call := &credentialCall{}
+	call.wg.Add(1)
+	c.calls[accessKey] = call
+	c.mu.Unlock()
+
+	call.secretKey, call.err = c.lookup(accessKey)
+	call.wg.Done()
+
+	c.mu.Lock()
+	delete(c.calls, accessKey)
+	switch {
+	case call.err == nil:
+		c.store(accessKey, credentialEntry{secretKey: call.secretKey, expires: time.Now().Add(c.ttl)})
+	case errors.Is(call.err, errNoSuchUser):
+		c.store(accessKey, credentialEntry{err: call.err, expires: time.Now().Add(c.negativeTTL)})
+	default:
+		//网络错误等不缓存, 下次请求重新查询
+		logger.Error("credential lookup %s error:%s", accessKey, call.err.Error())
+	}
+	c.mu.Unlock()
+	return call.secretKey, call.err
+}
+
+//store 写入缓存, 调用方需持有锁
+func (c *CredentialCache) store(accessKey string, entry credentialEntry) {
+	if len(c.entries) >= maxCredentialEntries {
+		now := time.Now()
+		for k, v := range c.entries {
+			if now.After(v.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxCredentialEntries {
+			c.entries = make(map[string]credentialEntry)
+		}
+	}
+	c.entries[accessKey] = entry
+}
+
+//Invalidate 删除 ak 的缓存, 密钥变更或用户删除后调用
+func (c *CredentialCache) Invalidate(accessKey string) {
+	c.mu.Lock()
+	delete(c.entries, accessKey)
+	c.mu.Unlock()
+}
+
+//Purge 清空缓存
+func (c *CredentialCache) Purge() {
+	c.mu.Lock()
+	c.entries = make(map[string]credentialEntry)
+	c.mu.Unlock()
+}
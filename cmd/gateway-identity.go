@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"s3Gateway/internal/logger"
+)
+
+//网关自身调用 open api (secret_by_appid) 时使用的身份
+//优先级: 环境变量 > open_api.secret_file > open_api.app_id/secret
+
+const (
+	EnvOpenApiAppId  = "S3GATEWAY_OPEN_API_APP_ID"
+	EnvOpenApiSecret = "S3GATEWAY_OPEN_API_SECRET"
+	// identityReloadInterval 检查 secret_file 是否变化的间隔
+	identityReloadInterval = 30 * time.Second
+)
+
+// gatewayIdentity 网关身份, secret_file 使用相同的 yaml 格式
+type gatewayIdentity struct {
+	AppId  string `yaml:"app_id"`
+	Secret string `yaml:"secret"`
+}
+
+var globalIdentity atomic.Value
+
+//LoadGatewayIdentity 加载网关身份, 失败时保留之前的身份
+func LoadGatewayIdentity() error {
+	id := gatewayIdentity{
+		AppId:  GlobalConfig.OpenApi.AppId,
+		Secret: GlobalConfig.OpenApi.Secret,
+	}
+	if path := GlobalConfig.OpenApi.SecretFile; path != "" {
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		fileId := gatewayIdentity{}
+		if err := yaml.Unmarshal(buf, &fileId); err != nil {
+			return err
+		}
+		if fileId.AppId != "" {
+			id.AppId = fileId.AppId
+		}
+		if fileId.Secret != "" {
+			id.Secret = fileId.Secret
+		}
+	}
+	if v := os.Getenv(EnvOpenApiAppId); v != "" {
+		id.AppId = v
+	}
+	if v := os.Getenv(EnvOpenApiSecret); v != "" {
+		id.Secret = v
+	}
+	if id.AppId == "" || id.Secret == "" {
+		return errors.New("open_api app_id or secret is empty")
+	}
+	globalIdentity.Store(id)
+	return nil
+}
+
+//getGatewayIdentity 返回当前的网关身份
+func getGatewayIdentity() gatewayIdentity {
+	id, _ := globalIdentity.Load().(gatewayIdentity)
+	return id
+}
+
+//WatchGatewayIdentity secret_file 修改后自动重新加载, 密钥轮换无需重启
+func WatchGatewayIdentity() {
+	path := GlobalConfig.OpenApi.SecretFile
+	if path == "" {
+		return
+	}
+	var lastModTime time.Time
+	if fi, err := os.Stat(path); err == nil {
+		lastModTime = fi.ModTime()
+	}
+	for range time.Tick(identityReloadInterval) {
+		fi, err := os.Stat(path)
+		if err != nil || fi.ModTime().Equal(lastModTime) {
+			continue
+		}
+		lastModTime = fi.ModTime()
+		if err := LoadGatewayIdentity(); err != nil {
+			logger.Error("reload gateway identity error:%s", err.Error())
+			continue
+		}
+		logger.Info("gateway identity reloaded from %s", path)
+	}
+}
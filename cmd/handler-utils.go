@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	xhttp "s3Gateway/internal/http"
+	"strings"
+)
+
+const (
+	// maxUserMetadataSize x-amz-meta-* 用户元数据的总长度上限
+	maxUserMetadataSize = 2 * 1024
+	userMetadataPrefix  = "X-Amz-Meta-"
+)
+
+// supportedHeaders 随对象保存并在 GET/HEAD 时原样返回的请求头
+var supportedHeaders = []string{
+	xhttp.ContentType,
+	xhttp.ContentDisposition,
+	xhttp.CacheControl,
+	xhttp.ContentEncoding,
+	xhttp.ContentLanguage,
+	xhttp.Expires,
+	xhttp.AmzStorageClass,
+}
+
+// supportedStorageClasses 网关接受的存储类型
+var supportedStorageClasses = map[string]bool{
+	"STANDARD":           true,
+	"REDUCED_REDUNDANCY": true,
+}
+
+//extractMetadata 提取需要随对象保存的请求头: supportedHeaders 及 x-amz-meta-*
+func extractMetadata(header http.Header) (map[string]string, APIErrorCode) {
+	metadata := filterMetadata(header)
+	if storageClass, ok := metadata[http.CanonicalHeaderKey(xhttp.AmzStorageClass)]; ok && !supportedStorageClasses[storageClass] {
+		return nil, ErrInvalidStorageClass
+	}
+	size := 0
+	for k, v := range metadata {
+		if strings.HasPrefix(k, userMetadataPrefix) {
+			size += len(k) + len(v)
+		}
+	}
+	if size > maxUserMetadataSize {
+		return nil, ErrMetadataTooLarge
+	}
+	return metadata, ErrNone
+}
+
+//filterMetadata 只保留 supportedHeaders 及 x-amz-meta-*, key 统一为规范格式
+func filterMetadata(header http.Header) map[string]string {
+	metadata := make(map[string]string)
+	for _, k := range supportedHeaders {
+		if v := header.Get(k); v != "" {
+			metadata[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+	for k, v := range header {
+		if len(v) == 0 {
+			continue
+		}
+		if k = http.CanonicalHeaderKey(k); strings.HasPrefix(k, userMetadataPrefix) {
+			metadata[k] = strings.Join(v, ",")
+		}
+	}
+	return metadata
+}
+
+//objectMetadata 从对象信息中取出复制对象时需要保留的元数据
+func objectMetadata(objInfo ObjectInfo) map[string]string {
+	header := make(http.Header, len(objInfo.UserDefined)+1)
+	for k, v := range objInfo.UserDefined {
+		header.Set(k, v)
+	}
+	if objInfo.ContentType != "" {
+		header.Set(xhttp.ContentType, objInfo.ContentType)
+	}
+	return filterMetadata(header)
+}
+
+//errRecorderReader 记录读取请求体时出现的第一个错误
+type errRecorderReader struct {
+	io.Reader
+	err error
+}
+
+func (r *errRecorderReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err != nil && err != io.EOF && r.err == nil {
+		r.err = err
+	}
+	return n, err
+}
+
+//getObjectLocation 返回对象的完整访问地址
+func getObjectLocation(r *http.Request, bucket, object string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	u := &url.URL{
+		Scheme: scheme,
+		Host:   r.Host,
+		Path:   "/" + bucket + "/" + object,
+	}
+	return u.String()
+}
+
+// readCloser 组合 Reader 与 Closer, 用于截取部分数据后仍能关闭原始数据流
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
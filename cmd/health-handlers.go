@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+//健康检查及版本接口, 不需要鉴权, 供编排系统探测
+//网关自身的接口都在保留前缀 GatewayPathPrefix 下, 不会与桶名冲突, 不能通过网关创建同名桶
+//  GET|HEAD {HealthLivePath}  进程存活即返回 200
+//  GET|HEAD {HealthReadyPath} 配置已加载且 openApi 及 ak 查询可用时返回 200, 否则 503
+//  GET {VersionPath}          构建信息
+
+const (
+	// GatewayPathPrefix 网关自身接口的保留路径前缀
+	GatewayPathPrefix = "/s3gateway"
+	HealthLivePath    = GatewayPathPrefix + "/health/live"
+	HealthReadyPath   = GatewayPathPrefix + "/health/ready"
+	VersionPath       = GatewayPathPrefix + "/version"
+	// readyCacheDuration 就绪检查结果的缓存时间, 避免探测频繁请求 openApi
+	readyCacheDuration = 5 * time.Second
+	// readyCheckTimeout 检查 openApi 地址连通性的超时
+	readyCheckTimeout = 2 * time.Second
+)
+
+//构建信息, 编译时通过 -ldflags 设置, 例如
+//  go build -ldflags "-X s3Gateway/cmd.Version=v1.0.0 -X s3Gateway/cmd.CommitID=$(git rev-parse HEAD) -X s3Gateway/cmd.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	Version   = "DEVELOPMENT"
+	CommitID  = ""
+	BuildTime = ""
+)
+
+const (
+	checkOk     = "ok"
+	statusReady = "ready"
+	statusFail  = "not ready"
+)
+
+type readyResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+type versionResponse struct {
+	Version   string `json:"version"`
+	CommitID  string `json:"commitId,omitempty"`
+	BuildTime string `json:"buildTime,omitempty"`
+	GoVersion string `json:"goVersion"`
+}
+
+var (
+	readyMu      sync.Mutex
+	readyChecked time.Time
+	readyResult  readyResponse
+	// readyClient 只检查 openApi 地址是否可以建立连接并返回响应
+	readyClient = &http.Client{Timeout: readyCheckTimeout}
+)
+
+//IsGatewayEndpoint 匹配网关自身的接口(监控、健康检查、版本), 虚拟主机风格的请求为桶下的对象
+func IsGatewayEndpoint(r *http.Request, _ *mux.RouteMatch) bool {
+	_, ok := virtualHostBucket(r.Host, GlobalConfig.Http.Domains)
+	return !ok
+}
+
+//LiveHandler GET|HEAD {HealthLivePath}
+func LiveHandler(w http.ResponseWriter, r *http.Request) {
+	WriteSuccessResponseHeadersOnly(w)
+}
+
+//ReadyHandler GET|HEAD {HealthReadyPath}
+func ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	result := checkReady()
+	status := http.StatusOK
+	if result.Status != statusReady {
+		status = http.StatusServiceUnavailable
+	}
+	if r.Method == http.MethodHead {
+		WriteResponse(w, status, nil, mimeNone)
+		return
+	}
+	body, _ := json.Marshal(result)
+	WriteResponse(w, status, body, mimeJSON)
+}
+
+//VersionHandler GET {VersionPath}
+func VersionHandler(w http.ResponseWriter, r *http.Request) {
+	body, _ := json.Marshal(versionResponse{
+		Version:   Version,
+		CommitID:  CommitID,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	})
+	WriteResponse(w, http.StatusOK, body, mimeJSON)
+}
+
+//checkReady 检查配置、openApi 地址及 ak 查询, 结果缓存 readyCacheDuration
+func checkReady() readyResponse {
+	readyMu.Lock()
+	defer readyMu.Unlock()
+	if time.Since(readyChecked) < readyCacheDuration {
+		return readyResult
+	}
+	checks := make(map[string]string)
+	ready := true
+	fail := func(name string, err error) {
+		checks[name] = err.Error()
+		ready = false
+	}
+	if GlobalConfig == nil || GlobalBackend == nil {
+		fail("config", errors.New("config not loaded"))
+	} else {
+		checks["config"] = checkOk
+		if GlobalConfig.Backend.Type != "fs" {
+			if err := checkOpenApiHost(); err != nil {
+				fail("open_api", err)
+			} else {
+				checks["open_api"] = checkOk
+			}
+			//查询网关自身的 app_id, openApi 返回用户不存在同样说明查询可用
+			if _, err := GlobalBackend.UserSecret(getGatewayIdentity().AppId); err != nil && !errors.Is(err, errNoSuchUser) {
+				fail("credentials", err)
+			} else {
+				checks["credentials"] = checkOk
+			}
+		}
+	}
+	readyResult = readyResponse{Status: statusReady, Checks: checks}
+	if !ready {
+		readyResult.Status = statusFail
+	}
+	readyChecked = time.Now()
+	return readyResult
+}
+
+//checkOpenApiHost openApi 地址返回任意 http 响应即认为可达
+func checkOpenApiHost() error {
+	req, err := http.NewRequest(http.MethodHead, GlobalConfig.OpenApi.Host, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "s3gateway-health-check")
+	resp, err := readyClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
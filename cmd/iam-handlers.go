@@ -0,0 +1,319 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	iampolicy "github.com/minio/pkg/iam/policy"
+	"s3Gateway/internal/auth"
+	"s3Gateway/internal/logger"
+)
+
+//IAM 管理接口, 请求需要签名, 调用者为 iam.admins 中的 ak 或由 IAM 策略授予对应的 admin: 操作
+//  GET|PUT|DELETE {AdminPathPrefix}/policies[/{name}]  请求体为策略 JSON
+//  GET|PUT|DELETE {AdminPathPrefix}/users[/{user}]     请求体 {"status":"on","policies":[...]}
+//  GET|PUT|DELETE {AdminPathPrefix}/groups[/{group}]   请求体 {"status":"on","members":[...],"policies":[...]}
+
+const (
+	// AdminPathPrefix 管理接口路径前缀, 需在桶路由之前注册
+	AdminPathPrefix = GatewayPathPrefix + "/admin/v1"
+	// maxAdminRequestSize 用户、组请求体上限
+	maxAdminRequestSize = 1024 * 1024
+)
+
+type Admin struct {
+	IAM *IAMStore
+}
+
+// iamUserInfo GetUser 响应
+type iamUserInfo struct {
+	iamUser
+	Groups []string `json:"groups"`
+}
+
+//ListPolicies GET /policies
+func (a *Admin) ListPolicies(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiAdminListPolicies)
+	if !checkAdminRequest(ctx, w, r, iampolicy.ListUserPoliciesAdminAction) {
+		return
+	}
+	writeAdminResponse(ctx, w, r, a.IAM.ListPolicies())
+}
+
+//GetPolicy GET /policies/{name}
+func (a *Admin) GetPolicy(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiAdminGetPolicy)
+	if !checkAdminRequest(ctx, w, r, iampolicy.GetPolicyAdminAction) {
+		return
+	}
+	p, err := a.IAM.GetPolicy(mux.Vars(r)["name"])
+	if err != nil {
+		writeIAMError(ctx, w, r, err)
+		return
+	}
+	writeAdminResponse(ctx, w, r, p)
+}
+
+//PutPolicy PUT /policies/{name}
+func (a *Admin) PutPolicy(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiAdminPutPolicy)
+	if !checkAdminRequest(ctx, w, r, iampolicy.CreatePolicyAdminAction) {
+		return
+	}
+	body, ok := readAdminBody(ctx, w, r, maxIAMPolicySize)
+	if !ok {
+		return
+	}
+	p, err := iampolicy.ParseConfig(bytes.NewReader(body))
+	if err != nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErrWithErr(ErrMalformedPolicy, err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if p.Version == "" || p.IsEmpty() {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrMalformedPolicy), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if err := a.IAM.SetPolicy(mux.Vars(r)["name"], body); err != nil {
+		writeIAMError(ctx, w, r, err)
+		return
+	}
+	WriteSuccessNoContent(w)
+}
+
+//DeletePolicy DELETE /policies/{name}
+func (a *Admin) DeletePolicy(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiAdminDeletePolicy)
+	if !checkAdminRequest(ctx, w, r, iampolicy.DeletePolicyAdminAction) {
+		return
+	}
+	if err := a.IAM.DeletePolicy(mux.Vars(r)["name"]); err != nil {
+		writeIAMError(ctx, w, r, err)
+		return
+	}
+	WriteSuccessNoContent(w)
+}
+
+//ListUsers GET /users
+func (a *Admin) ListUsers(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiAdminListUsers)
+	if !checkAdminRequest(ctx, w, r, iampolicy.ListUsersAdminAction) {
+		return
+	}
+	writeAdminResponse(ctx, w, r, a.IAM.ListUsers())
+}
+
+//GetUser GET /users/{user}
+func (a *Admin) GetUser(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiAdminGetUser)
+	if !checkAdminRequest(ctx, w, r, iampolicy.GetUserAdminAction) {
+		return
+	}
+	u, groups, err := a.IAM.GetUser(mux.Vars(r)["user"])
+	if err != nil {
+		writeIAMError(ctx, w, r, err)
+		return
+	}
+	writeAdminResponse(ctx, w, r, iamUserInfo{iamUser: u, Groups: groups})
+}
+
+//PutUser PUT /users/{user}, 用户必须是存储后端已存在的 ak
+func (a *Admin) PutUser(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiAdminPutUser)
+	if !checkAdminRequest(ctx, w, r, iampolicy.CreateUserAdminAction) {
+		return
+	}
+	body, ok := readAdminBody(ctx, w, r, maxAdminRequestSize)
+	if !ok {
+		return
+	}
+	u := iamUser{}
+	if err := json.Unmarshal(body, &u); err != nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErrWithErr(ErrMalformedJSON, err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if u.Status, ok = parseAccountStatus(u.Status); !ok {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrAdminInvalidArgument), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	accessKey := mux.Vars(r)["user"]
+	if err := checkBackendUsers(accessKey); err != nil {
+		writeIAMError(ctx, w, r, err)
+		return
+	}
+	if err := a.IAM.SetUser(accessKey, u); err != nil {
+		writeIAMError(ctx, w, r, err)
+		return
+	}
+	WriteSuccessNoContent(w)
+}
+
+//DeleteUser DELETE /users/{user}, 只删除网关侧的 IAM 配置
+func (a *Admin) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiAdminDeleteUser)
+	if !checkAdminRequest(ctx, w, r, iampolicy.DeleteUserAdminAction) {
+		return
+	}
+	if err := a.IAM.DeleteUser(mux.Vars(r)["user"]); err != nil {
+		writeIAMError(ctx, w, r, err)
+		return
+	}
+	WriteSuccessNoContent(w)
+}
+
+//ListGroups GET /groups
+func (a *Admin) ListGroups(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiAdminListGroups)
+	if !checkAdminRequest(ctx, w, r, iampolicy.ListGroupsAdminAction) {
+		return
+	}
+	writeAdminResponse(ctx, w, r, a.IAM.ListGroups())
+}
+
+//GetGroup GET /groups/{group}
+func (a *Admin) GetGroup(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiAdminGetGroup)
+	if !checkAdminRequest(ctx, w, r, iampolicy.GetGroupAdminAction) {
+		return
+	}
+	g, err := a.IAM.GetGroup(mux.Vars(r)["group"])
+	if err != nil {
+		writeIAMError(ctx, w, r, err)
+		return
+	}
+	writeAdminResponse(ctx, w, r, g)
+}
+
+//PutGroup PUT /groups/{group}, 成员必须是存储后端已存在的 ak
+func (a *Admin) PutGroup(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiAdminPutGroup)
+	if !checkAdminRequest(ctx, w, r, iampolicy.AddUserToGroupAdminAction) {
+		return
+	}
+	body, ok := readAdminBody(ctx, w, r, maxAdminRequestSize)
+	if !ok {
+		return
+	}
+	g := iamGroup{}
+	if err := json.Unmarshal(body, &g); err != nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErrWithErr(ErrMalformedJSON, err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if g.Status, ok = parseAccountStatus(g.Status); !ok {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrAdminInvalidArgument), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if err := checkBackendUsers(g.Members...); err != nil {
+		writeIAMError(ctx, w, r, err)
+		return
+	}
+	if err := a.IAM.SetGroup(mux.Vars(r)["group"], g); err != nil {
+		writeIAMError(ctx, w, r, err)
+		return
+	}
+	WriteSuccessNoContent(w)
+}
+
+//DeleteGroup DELETE /groups/{group}, 组内仍有成员时失败
+func (a *Admin) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiAdminDeleteGroup)
+	if !checkAdminRequest(ctx, w, r, iampolicy.RemoveUserFromGroupAdminAction) {
+		return
+	}
+	if err := a.IAM.DeleteGroup(mux.Vars(r)["group"]); err != nil {
+		writeIAMError(ctx, w, r, err)
+		return
+	}
+	WriteSuccessNoContent(w)
+}
+
+//checkAdminRequest 鉴权失败时写入错误响应并返回 false
+func checkAdminRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, action iampolicy.AdminAction) bool {
+	cred, s3Error := checkAdminRequestAuth(ctx, r, action)
+	if s3Error != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
+		return false
+	}
+	if err := SetKey(ctx, cred); err != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(err), r.URL, guessIsBrowserReq(r))
+		return false
+	}
+	return true
+}
+
+//readAdminBody 读取请求体, 超过 maxSize 时返回 ErrAdminConfigTooLarge
+func readAdminBody(ctx context.Context, w http.ResponseWriter, r *http.Request, maxSize int64) ([]byte, bool) {
+	if r.ContentLength > maxSize {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrAdminConfigTooLarge), r.URL, guessIsBrowserReq(r))
+		return nil, false
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxSize+1))
+	if err != nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(toAPIErrorCode(ctx, err)), r.URL, guessIsBrowserReq(r))
+		return nil, false
+	}
+	if int64(len(body)) > maxSize {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrAdminConfigTooLarge), r.URL, guessIsBrowserReq(r))
+		return nil, false
+	}
+	if len(body) == 0 {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrMissingRequestBodyError), r.URL, guessIsBrowserReq(r))
+		return nil, false
+	}
+	return body, true
+}
+
+func writeAdminResponse(ctx context.Context, w http.ResponseWriter, r *http.Request, v interface{}) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		logger.Error("encode admin response error:%s", err.Error())
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrInternalError), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	WriteSuccessResponseJSON(w, buf)
+}
+
+//writeIAMError IAM 存储返回的错误转换为管理接口错误
+func writeIAMError(ctx context.Context, w http.ResponseWriter, r *http.Request, err error) {
+	var apiErr *APIError
+	switch {
+	case errors.Is(err, errPolicyInUse):
+		apiErr = errorCodes.ToAPIErrWithErr(ErrAdminInvalidArgument, err)
+	case errors.Is(err, errNoSuchUser), errors.Is(err, errNoSuchGroup), errors.Is(err, errGroupNotEmpty),
+		errors.Is(err, errNoSuchPolicy), errors.Is(err, errInvalidArgument):
+		apiErr = errorCodes.ToAPIErr(toAPIErrorCode(ctx, err))
+	default:
+		logger.Error("iam store error:%s", err.Error())
+		apiErr = errorCodes.ToAPIErr(ErrInternalError)
+	}
+	WriteErrorResponse(ctx, w, apiErr, r.URL, guessIsBrowserReq(r))
+}
+
+//parseAccountStatus 为空时默认启用
+func parseAccountStatus(status string) (string, bool) {
+	switch status {
+	case "":
+		return auth.AccountOn, true
+	case auth.AccountOn, auth.AccountOff:
+		return status, true
+	}
+	return status, false
+}
+
+//checkBackendUsers 确认 ak 在存储后端存在
+func checkBackendUsers(accessKeys ...string) error {
+	for _, accessKey := range accessKeys {
+		if _, err := GlobalCredentialCache.Get(accessKey); err != nil {
+			if errors.Is(err, errNoSuchUser) {
+				return errNoSuchUser
+			}
+			return err
+		}
+	}
+	return nil
+}
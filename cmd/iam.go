@@ -0,0 +1,436 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/minio/pkg/bucket/policy"
+	iampolicy "github.com/minio/pkg/iam/policy"
+	"s3Gateway/internal/auth"
+)
+
+//网关侧 IAM: 用户(存储后端的 ak)、组及可附加的策略, 保存在网关本地 <dir>/iam.json
+//iam.enable 开启后, 非管理员的已认证请求需要由用户或所在组的策略允许, 或由桶策略允许
+
+const (
+	iamConfigFile = "iam.json"
+	// maxIAMPolicySize 单个策略大小上限
+	maxIAMPolicySize = 20 * 1024
+)
+
+// cannedPolicies 内置策略, 不能修改或删除
+var cannedPolicies = map[string]iampolicy.Policy{
+	"readwrite": iampolicy.ReadWrite,
+	"readonly":  iampolicy.ReadOnly,
+	"writeonly": iampolicy.WriteOnly,
+}
+
+// iamUser 用户状态及直接附加的策略, Status 为 auth.AccountOn/AccountOff
+type iamUser struct {
+	Status   string   `json:"status"`
+	Policies []string `json:"policies"`
+}
+
+// iamGroup 组成员、状态及附加的策略
+type iamGroup struct {
+	Status   string   `json:"status"`
+	Members  []string `json:"members"`
+	Policies []string `json:"policies"`
+}
+
+// iamData iam.json 的内容
+type iamData struct {
+	Policies map[string]json.RawMessage `json:"policies"`
+	Users    map[string]iamUser         `json:"users"`
+	Groups   map[string]iamGroup        `json:"groups"`
+}
+
+// IAMStore IAM 数据存储, 启动时全部加载到内存
+type IAMStore struct {
+	path     string
+	mu       sync.RWMutex
+	data     iamData
+	policies map[string]iampolicy.Policy
+}
+
+// GlobalIAMStore 鉴权时使用, main 中初始化
+var GlobalIAMStore *IAMStore
+
+func NewIAMStore(dir string) (*IAMStore, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &IAMStore{path: filepath.Join(dir, iamConfigFile)}
+	data := iamData{}
+	buf, err := ioutil.ReadFile(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(buf, &data); err != nil {
+			return nil, errors.New("corrupted iam config " + s.path)
+		}
+	}
+	if err := s.load(data); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+//load 解析策略并替换内存中的数据, 调用方需持有写锁或在初始化时调用
+func (s *IAMStore) load(data iamData) error {
+	if data.Policies == nil {
+		data.Policies = make(map[string]json.RawMessage)
+	}
+	if data.Users == nil {
+		data.Users = make(map[string]iamUser)
+	}
+	if data.Groups == nil {
+		data.Groups = make(map[string]iamGroup)
+	}
+	policies := make(map[string]iampolicy.Policy, len(cannedPolicies)+len(data.Policies))
+	for name, p := range cannedPolicies {
+		policies[name] = p
+	}
+	for name, raw := range data.Policies {
+		p, err := iampolicy.ParseConfig(bytes.NewReader(raw))
+		if err != nil {
+			return errors.New("invalid iam policy " + name + ": " + err.Error())
+		}
+		policies[name] = *p
+	}
+	s.data = data
+	s.policies = policies
+	return nil
+}
+
+//update 在数据副本上修改, 写入磁盘成功后才替换内存中的数据
+func (s *IAMStore) update(fn func(data *iamData) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	buf, err := json.Marshal(s.data)
+	if err != nil {
+		return err
+	}
+	data := iamData{}
+	if err := json.Unmarshal(buf, &data); err != nil {
+		return err
+	}
+	if err := fn(&data); err != nil {
+		return err
+	}
+	if buf, err = json.MarshalIndent(data, "", "  "); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return s.load(data)
+}
+
+//checkPolicies 确认策略均已存在, 调用方需持有锁
+func (s *IAMStore) checkPolicies(data *iamData, names []string) error {
+	for _, name := range names {
+		if _, ok := cannedPolicies[name]; ok {
+			continue
+		}
+		if _, ok := data.Policies[name]; !ok {
+			return errNoSuchPolicy
+		}
+	}
+	return nil
+}
+
+//ListPolicies 返回全部策略名称, 包括内置策略
+func (s *IAMStore) ListPolicies() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.policies))
+	for name := range s.policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//GetPolicy 返回策略
+func (s *IAMStore) GetPolicy(name string) (iampolicy.Policy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.policies[name]
+	if !ok {
+		return p, errNoSuchPolicy
+	}
+	return p, nil
+}
+
+//SetPolicy 新建或替换策略, raw 已由 iampolicy.ParseConfig 校验
+func (s *IAMStore) SetPolicy(name string, raw []byte) error {
+	if _, ok := cannedPolicies[name]; ok {
+		return errInvalidArgument
+	}
+	return s.update(func(data *iamData) error {
+		data.Policies[name] = raw
+		return nil
+	})
+}
+
+//DeletePolicy 删除策略, 策略仍附加在用户或组上时返回 errPolicyInUse
+func (s *IAMStore) DeletePolicy(name string) error {
+	if _, ok := cannedPolicies[name]; ok {
+		return errInvalidArgument
+	}
+	return s.update(func(data *iamData) error {
+		if _, ok := data.Policies[name]; !ok {
+			return errNoSuchPolicy
+		}
+		for _, u := range data.Users {
+			if containsString(u.Policies, name) {
+				return errPolicyInUse
+			}
+		}
+		for _, g := range data.Groups {
+			if containsString(g.Policies, name) {
+				return errPolicyInUse
+			}
+		}
+		delete(data.Policies, name)
+		return nil
+	})
+}
+
+//ListUsers 返回已配置的用户
+func (s *IAMStore) ListUsers() map[string]iamUser {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	users := make(map[string]iamUser, len(s.data.Users))
+	for ak, u := range s.data.Users {
+		users[ak] = u
+	}
+	return users
+}
+
+//GetUser 返回用户及其所在的组
+func (s *IAMStore) GetUser(accessKey string) (iamUser, []string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.data.Users[accessKey]
+	if !ok {
+		return u, nil, errNoSuchUser
+	}
+	return u, s.groupsOf(accessKey), nil
+}
+
+//SetUser 新建或替换用户的状态及策略
+func (s *IAMStore) SetUser(accessKey string, u iamUser) error {
+	return s.update(func(data *iamData) error {
+		if err := s.checkPolicies(data, u.Policies); err != nil {
+			return err
+		}
+		data.Users[accessKey] = u
+		return nil
+	})
+}
+
+//DeleteUser 删除用户并将其移出所有组
+func (s *IAMStore) DeleteUser(accessKey string) error {
+	return s.update(func(data *iamData) error {
+		if _, ok := data.Users[accessKey]; !ok {
+			return errNoSuchUser
+		}
+		delete(data.Users, accessKey)
+		for name, g := range data.Groups {
+			g.Members = removeString(g.Members, accessKey)
+			data.Groups[name] = g
+		}
+		return nil
+	})
+}
+
+//ListGroups 返回全部组
+func (s *IAMStore) ListGroups() map[string]iamGroup {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	groups := make(map[string]iamGroup, len(s.data.Groups))
+	for name, g := range s.data.Groups {
+		groups[name] = g
+	}
+	return groups
+}
+
+//GetGroup 返回组
+func (s *IAMStore) GetGroup(name string) (iamGroup, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	g, ok := s.data.Groups[name]
+	if !ok {
+		return g, errNoSuchGroup
+	}
+	return g, nil
+}
+
+//SetGroup 新建或替换组
+func (s *IAMStore) SetGroup(name string, g iamGroup) error {
+	return s.update(func(data *iamData) error {
+		if err := s.checkPolicies(data, g.Policies); err != nil {
+			return err
+		}
+		data.Groups[name] = g
+		return nil
+	})
+}
+
+//DeleteGroup 删除组, 组内仍有成员时返回 errGroupNotEmpty
+func (s *IAMStore) DeleteGroup(name string) error {
+	return s.update(func(data *iamData) error {
+		g, ok := data.Groups[name]
+		if !ok {
+			return errNoSuchGroup
+		}
+		if len(g.Members) > 0 {
+			return errGroupNotEmpty
+		}
+		delete(data.Groups, name)
+		return nil
+	})
+}
+
+//groupsOf 用户所在的组, 调用方需持有锁
+func (s *IAMStore) groupsOf(accessKey string) []string {
+	var groups []string
+	for name, g := range s.data.Groups {
+		if containsString(g.Members, accessKey) {
+			groups = append(groups, name)
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+//PolicyFor 合并用户及所在启用组附加的策略, 用户被禁用时 enabled 为 false
+func (s *IAMStore) PolicyFor(accessKey string) (p iampolicy.Policy, groups []string, enabled bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var names []string
+	if u, ok := s.data.Users[accessKey]; ok {
+		if u.Status == auth.AccountOff {
+			return p, nil, false
+		}
+		names = append(names, u.Policies...)
+	}
+	for _, name := range s.groupsOf(accessKey) {
+		g := s.data.Groups[name]
+		if g.Status == auth.AccountOff {
+			continue
+		}
+		groups = append(groups, name)
+		names = append(names, g.Policies...)
+	}
+	for _, name := range names {
+		if attached, ok := s.policies[name]; ok {
+			p = p.Merge(attached)
+		}
+	}
+	return p, groups, true
+}
+
+//isIAMUserEnabled 开启 iam 时用户未被禁用
+func isIAMUserEnabled(accessKey string) bool {
+	if !GlobalConfig.Iam.Enable || isIAMAdmin(accessKey) {
+		return true
+	}
+	_, _, enabled := GlobalIAMStore.PolicyFor(accessKey)
+	return enabled
+}
+
+//isIAMAdmin iam.admins 中的 ak, 不受 IAM 策略限制
+func isIAMAdmin(accessKey string) bool {
+	return accessKey != "" && containsString(GlobalConfig.Iam.Admins, accessKey)
+}
+
+//checkIAMPolicy 按 IAM 策略鉴权已认证请求
+//  - 未开启 iam 或管理员: 允许
+//  - 用户被禁用或策略命中 Deny: 拒绝
+//  - 策略 Allow 或桶策略 Allow: 允许
+func checkIAMPolicy(r *http.Request, action policy.Action, bucketName, objectName string, cred auth.Credentials) APIErrorCode {
+	if !GlobalConfig.Iam.Enable || isIAMAdmin(cred.AccessKey) {
+		return ErrNone
+	}
+	p, groups, enabled := GlobalIAMStore.PolicyFor(cred.AccessKey)
+	if !enabled {
+		return ErrAccessDenied
+	}
+	args := iampolicy.Args{
+		AccountName:     cred.AccessKey,
+		Groups:          groups,
+		Action:          iampolicy.Action(action),
+		BucketName:      bucketName,
+		ObjectName:      objectName,
+		ConditionValues: getConditionValues(r, cred),
+		DenyOnly:        true,
+	}
+	//显式 Deny 优先于桶策略的 Allow
+	if !p.IsAllowed(args) {
+		return ErrAccessDenied
+	}
+	args.DenyOnly = false
+	if p.IsAllowed(args) || isAllowedByBucketPolicy(r, action, bucketName, objectName, cred) {
+		return ErrNone
+	}
+	return ErrAccessDenied
+}
+
+//isIAMAdminAllowed 管理员或 IAM 策略允许的管理操作
+func isIAMAdminAllowed(r *http.Request, action iampolicy.AdminAction, cred auth.Credentials) bool {
+	if isIAMAdmin(cred.AccessKey) {
+		return true
+	}
+	if !GlobalConfig.Iam.Enable {
+		return false
+	}
+	p, groups, enabled := GlobalIAMStore.PolicyFor(cred.AccessKey)
+	if !enabled {
+		return false
+	}
+	return p.IsAllowed(iampolicy.Args{
+		AccountName:     cred.AccessKey,
+		Groups:          groups,
+		Action:          iampolicy.Action(action),
+		ConditionValues: getConditionValues(r, cred),
+	})
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func removeString(list []string, s string) []string {
+	out := list[:0]
+	for _, v := range list {
+		if v != s {
+			out = append(out, v)
+		}
+	}
+	return out
+}
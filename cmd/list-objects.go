@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strconv"
+	"strings"
+
+	mxml "s3Gateway/model/xml"
+)
+
+//ListObjects V1/V2 公共逻辑: 参数解析、prefix/delimiter 归并、分页及响应生成
+
+// listObjectsInfo 分页后的对象列表
+type listObjectsInfo struct {
+	IsTruncated bool
+	// NextMarker 本页最后一个 key 或 CommonPrefix
+	NextMarker string
+	Objects    []ObjectInfo
+	Prefixes   []string
+}
+
+//listObjects 从按 key 升序排列的对象中取出 marker 之后的一页,
+//delimiter 不为空时 prefix 之后第一次出现 delimiter 的 key 合并为 CommonPrefix
+func listObjects(objects []ObjectInfo, prefix, marker, delimiter string, maxKeys int) listObjectsInfo {
+	result := listObjectsInfo{}
+	if maxKeys == 0 {
+		return result
+	}
+	for _, obj := range objects {
+		if obj.Name <= marker || !strings.HasPrefix(obj.Name, prefix) {
+			continue
+		}
+		commonPrefix := ""
+		if delimiter != "" {
+			if i := strings.Index(obj.Name[len(prefix):], delimiter); i >= 0 {
+				commonPrefix = obj.Name[:len(prefix)+i+len(delimiter)]
+			}
+		}
+		if commonPrefix != "" {
+			//marker 本身是 CommonPrefix 时, 该前缀下的对象都已返回过
+			if commonPrefix <= marker {
+				continue
+			}
+			if n := len(result.Prefixes); n > 0 && result.Prefixes[n-1] == commonPrefix {
+				continue
+			}
+		}
+		if len(result.Objects)+len(result.Prefixes) == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		if commonPrefix != "" {
+			result.Prefixes = append(result.Prefixes, commonPrefix)
+			result.NextMarker = commonPrefix
+		} else {
+			result.Objects = append(result.Objects, obj)
+			result.NextMarker = obj.Name
+		}
+	}
+	if !result.IsTruncated {
+		result.NextMarker = ""
+	}
+	return result
+}
+
+//parseMaxKeys 解析 max-keys, 超过 maxObjectList 时按 maxObjectList 处理
+func parseMaxKeys(values url.Values) (int, APIErrorCode) {
+	maxKeys := maxObjectList
+	if v := values.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, ErrInvalidMaxKeys
+		}
+		if n < maxKeys {
+			maxKeys = n
+		}
+	}
+	return maxKeys, ErrNone
+}
+
+//getListObjectsV1Args 解析 ListObjectsV1 参数
+func getListObjectsV1Args(values url.Values) (prefix, marker, delimiter string, maxKeys int, encodingType string, errCode APIErrorCode) {
+	if maxKeys, errCode = parseMaxKeys(values); errCode != ErrNone {
+		return
+	}
+	encodingType = values.Get("encoding-type")
+	if encodingType != "" && !strings.EqualFold(encodingType, "url") {
+		errCode = ErrInvalidEncodingMethod
+		return
+	}
+	prefix = values.Get("prefix")
+	marker = values.Get("marker")
+	delimiter = values.Get("delimiter")
+	return
+}
+
+//getListObjectsV2Args 解析 ListObjectsV2 参数, continuation-token 为 base64 编码的 key
+func getListObjectsV2Args(values url.Values) (prefix, token, startAfter, delimiter string, fetchOwner bool, maxKeys int, encodingType string, errCode APIErrorCode) {
+	if maxKeys, errCode = parseMaxKeys(values); errCode != ErrNone {
+		return
+	}
+	encodingType = values.Get("encoding-type")
+	if encodingType != "" && !strings.EqualFold(encodingType, "url") {
+		errCode = ErrInvalidEncodingMethod
+		return
+	}
+	if _, ok := values["continuation-token"]; ok {
+		token = values.Get("continuation-token")
+		if _, err := base64.StdEncoding.DecodeString(token); err != nil || token == "" {
+			errCode = ErrIncorrectContinuationToken
+			return
+		}
+	}
+	prefix = values.Get("prefix")
+	startAfter = values.Get("start-after")
+	delimiter = values.Get("delimiter")
+	fetchOwner = values.Get("fetch-owner") == "true"
+	return
+}
+
+//s3EncodeName encoding-type=url 时对 key 做 url 编码, 保留 "/"
+func s3EncodeName(name, encodingType string) string {
+	if encodingType == "" {
+		return name
+	}
+	segments := strings.Split(name, SlashSeparator)
+	for i, segment := range segments {
+		segments[i] = url.QueryEscape(segment)
+	}
+	return strings.Join(segments, SlashSeparator)
+}
+
+func listObjectsContents(objects []ObjectInfo, encodingType string, owner *mxml.ListObjectResultContentOwner) []*mxml.ListObjectResultContent {
+	contents := make([]*mxml.ListObjectResultContent, 0, len(objects))
+	for _, obj := range objects {
+		storageClass := obj.StorageClass
+		if storageClass == "" {
+			storageClass = "STANDARD"
+		}
+		contents = append(contents, &mxml.ListObjectResultContent{
+			Key:          s3EncodeName(obj.Name, encodingType),
+			LastModified: obj.ModTime.UTC(),
+			ETag:         "\"" + obj.ETag + "\"",
+			Size:         int(obj.Size),
+			StorageClass: storageClass,
+			Owner:        owner,
+		})
+	}
+	return contents
+}
+
+func listObjectsCommonPrefixes(prefixes []string, encodingType string) []mxml.CommonPrefix {
+	commonPrefixes := make([]mxml.CommonPrefix, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		commonPrefixes = append(commonPrefixes, mxml.CommonPrefix{Prefix: s3EncodeName(prefix, encodingType)})
+	}
+	return commonPrefixes
+}
+
+//generateListObjectsV1Response 生成 ListObjectsV1 响应
+func generateListObjectsV1Response(bucket, prefix, marker, delimiter, encodingType string, maxKeys int, info listObjectsInfo, owner *mxml.ListObjectResultContentOwner) mxml.ListObjectResult {
+	return mxml.ListObjectResult{
+		Xmlns:          s3Namespace,
+		Name:           bucket,
+		Prefix:         s3EncodeName(prefix, encodingType),
+		Marker:         s3EncodeName(marker, encodingType),
+		NextMarker:     s3EncodeName(info.NextMarker, encodingType),
+		MaxKeys:        maxKeys,
+		Delimiter:      s3EncodeName(delimiter, encodingType),
+		IsTruncated:    info.IsTruncated,
+		EncodingType:   encodingType,
+		Contents:       listObjectsContents(info.Objects, encodingType, owner),
+		CommonPrefixes: listObjectsCommonPrefixes(info.Prefixes, encodingType),
+	}
+}
+
+//generateListObjectsV2Response 生成 ListObjectsV2 响应
+func generateListObjectsV2Response(bucket, prefix, token, startAfter, delimiter, encodingType string, maxKeys int, info listObjectsInfo, owner *mxml.ListObjectResultContentOwner) mxml.ListObjectV2Result {
+	response := mxml.ListObjectV2Result{
+		Xmlns:             s3Namespace,
+		Name:              bucket,
+		Prefix:            s3EncodeName(prefix, encodingType),
+		StartAfter:        s3EncodeName(startAfter, encodingType),
+		ContinuationToken: token,
+		KeyCount:          len(info.Objects) + len(info.Prefixes),
+		MaxKeys:           maxKeys,
+		Delimiter:         s3EncodeName(delimiter, encodingType),
+		IsTruncated:       info.IsTruncated,
+		EncodingType:      encodingType,
+		Contents:          listObjectsContents(info.Objects, encodingType, owner),
+		CommonPrefixes:    listObjectsCommonPrefixes(info.Prefixes, encodingType),
+	}
+	if info.IsTruncated {
+		response.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(info.NextMarker))
+	}
+	return response
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+//Prometheus 监控指标, GET {MetricsPath} 不需要鉴权, 路由匹配规则见 IsGatewayEndpoint
+
+const (
+	// MetricsPath 监控指标路径
+	MetricsPath      = GatewayPathPrefix + "/metrics"
+	metricsNamespace = "s3gateway"
+)
+
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Total number of S3 requests by API and status code.",
+	}, []string{"api", "code"})
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Time taken to serve S3 requests by API.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300},
+	}, []string{"api"})
+	httpRequestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "http",
+		Name:      "requests_in_flight",
+		Help:      "Number of S3 requests currently being served.",
+	})
+	httpReceivedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "http",
+		Name:      "received_bytes_total",
+		Help:      "Total number of request body bytes received (uploaded) by API.",
+	}, []string{"api"})
+	httpSentBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "http",
+		Name:      "sent_bytes_total",
+		Help:      "Total number of response body bytes sent (downloaded) by API.",
+	}, []string{"api"})
+
+	openApiRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "openapi",
+		Name:      "requests_total",
+		Help:      "Total number of open api calls by endpoint.",
+	}, []string{"endpoint"})
+	openApiErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "openapi",
+		Name:      "errors_total",
+		Help:      "Total number of failed open api calls (transport error or non 2xx status) by endpoint.",
+	}, []string{"endpoint"})
+	openApiRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "openapi",
+		Name:      "request_duration_seconds",
+		Help:      "Time taken by open api calls until response headers are received, by endpoint.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"endpoint"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		httpRequestsTotal,
+		httpRequestDuration,
+		httpRequestsInFlight,
+		httpReceivedBytes,
+		httpSentBytes,
+		openApiRequestsTotal,
+		openApiErrorsTotal,
+		openApiRequestDuration,
+	)
+}
+
+//MetricsHandler GET {MetricsPath}
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+//recordRequestMetrics 记录一次 s3 请求
+func recordRequestMetrics(api string, statusCode int, duration time.Duration, bytesIn, bytesOut int64) {
+	if api == "" {
+		api = "unknown"
+	}
+	httpRequestsTotal.WithLabelValues(api, strconv.Itoa(statusCode)).Inc()
+	httpRequestDuration.WithLabelValues(api).Observe(duration.Seconds())
+	httpReceivedBytes.WithLabelValues(api).Add(float64(bytesIn))
+	httpSentBytes.WithLabelValues(api).Add(float64(bytesOut))
+}
+
+//recordOpenApiMetrics 记录一次 openApi 调用, endpoint 为请求路径
+func recordOpenApiMetrics(endpoint string, duration time.Duration, failed bool) {
+	endpoint = strings.TrimPrefix(endpoint, SlashSeparator)
+	openApiRequestsTotal.WithLabelValues(endpoint).Inc()
+	openApiRequestDuration.WithLabelValues(endpoint).Observe(duration.Seconds())
+	if failed {
+		openApiErrorsTotal.WithLabelValues(endpoint).Inc()
+	}
+}
@@ -0,0 +1,407 @@
+package cmd
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"s3Gateway/internal/etag"
+	"s3Gateway/internal/logger"
+	mxml "s3Gateway/model/xml"
+)
+
+//分片上传暂存区, 分片先写入本地磁盘, 合并时整体交给存储后端
+//<dir>/<uploadId>/upload.json 记录上传信息, <dir>/<uploadId>/<partNumber>.part 为分片数据
+//uploadId 只对发起上传的 ak (initiator) 可见, 其他 ak 访问时返回 NoSuchUpload
+//超过 expiry 未完成的上传由 CleanupLoop 定期删除
+
+const (
+	globalMaxPartID       = 10000
+	globalMinPartSize     = 5 * 1024 * 1024
+	multipartUploadJSON   = "upload.json"
+	multipartCompleteFlag = ".completing"
+	// defaultMultipartExpiry 未配置 multipart.expiry 时使用
+	defaultMultipartExpiry = 24 * time.Hour
+	// maxMultipartCleanupInterval 清理过期上传的最大间隔
+	maxMultipartCleanupInterval = time.Hour
+)
+
+// MultipartStore 分片暂存区
+type MultipartStore struct {
+	dir    string
+	expiry time.Duration
+}
+
+// multipartUpload 分片上传信息
+type multipartUpload struct {
+	UploadID    string            `json:"uploadId"`
+	Bucket      string            `json:"bucket"`
+	Object      string            `json:"object"`
+	Initiator   string            `json:"initiator"`
+	Initiated   time.Time         `json:"initiated"`
+	UserDefined map[string]string `json:"meta,omitempty"`
+}
+
+// partInfo 分片信息
+type partInfo struct {
+	PartNumber int       `json:"number"`
+	ETag       string    `json:"etag"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"modTime"`
+}
+
+//NewMultipartStore expiry 为 0 时使用 defaultMultipartExpiry
+func NewMultipartStore(dir string, expiry time.Duration) (*MultipartStore, error) {
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "s3gateway-multipart")
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if expiry <= 0 {
+		expiry = defaultMultipartExpiry
+	}
+	return &MultipartStore{dir: dir, expiry: expiry}, nil
+}
+
+func (m *MultipartStore) uploadDir(uploadID string) string {
+	return filepath.Join(m.dir, uploadID)
+}
+
+func partFile(partNumber int) string {
+	return fmt.Sprintf("%05d.part", partNumber)
+}
+
+func partMetaFile(partNumber int) string {
+	return fmt.Sprintf("%05d.json", partNumber)
+}
+
+//NewUpload 创建分片上传
+func (m *MultipartStore) NewUpload(bucket, object, initiator string, userDefined map[string]string) (string, error) {
+	uploadID, err := GenerateUUID()
+	if err != nil {
+		return "", err
+	}
+	if err := os.Mkdir(m.uploadDir(uploadID), 0755); err != nil {
+		return "", err
+	}
+	upload := multipartUpload{
+		UploadID:    uploadID,
+		Bucket:      bucket,
+		Object:      object,
+		Initiator:   initiator,
+		Initiated:   time.Now().UTC(),
+		UserDefined: userDefined,
+	}
+	if err := writeJSONFile(filepath.Join(m.uploadDir(uploadID), multipartUploadJSON), upload); err != nil {
+		os.RemoveAll(m.uploadDir(uploadID))
+		return "", err
+	}
+	return uploadID, nil
+}
+
+//GetUpload 读取上传信息, 同时校验 bucket/object 及 initiator 是否与 uploadId 对应
+func (m *MultipartStore) GetUpload(bucket, object, uploadID, initiator string) (multipartUpload, error) {
+	upload := multipartUpload{}
+	if uploadID == "" || strings.ContainsAny(uploadID, `/\.`) {
+		return upload, errUploadIDNotFound
+	}
+	if err := readJSONFile(filepath.Join(m.uploadDir(uploadID), multipartUploadJSON), &upload); err != nil {
+		return upload, errUploadIDNotFound
+	}
+	if upload.Bucket != bucket || upload.Object != object || upload.Initiator != initiator {
+		return upload, errUploadIDNotFound
+	}
+	return upload, nil
+}
+
+//PutPart 保存分片, 返回分片信息
+func (m *MultipartStore) PutPart(bucket, object, uploadID, initiator string, partNumber int, data io.Reader, size int64) (partInfo, error) {
+	part := partInfo{PartNumber: partNumber}
+	if _, err := m.GetUpload(bucket, object, uploadID, initiator); err != nil {
+		return part, err
+	}
+	dir := m.uploadDir(uploadID)
+	tmp, err := ioutil.TempFile(dir, "tmp-")
+	if err != nil {
+		return part, err
+	}
+	defer os.Remove(tmp.Name())
+	hasher := md5.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hasher), data)
+	tmp.Close()
+	if err != nil {
+		return part, err
+	}
+	if size >= 0 && n != size {
+		return part, errDataTooSmall
+	}
+	part.ETag = hex.EncodeToString(hasher.Sum(nil))
+	part.Size = n
+	part.ModTime = time.Now().UTC()
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, partFile(partNumber))); err != nil {
+		return part, errUploadIDNotFound
+	}
+	if err := writeJSONFile(filepath.Join(dir, partMetaFile(partNumber)), part); err != nil {
+		return part, err
+	}
+	return part, nil
+}
+
+//ListParts 按分片号升序返回已上传的分片
+func (m *MultipartStore) ListParts(bucket, object, uploadID, initiator string) ([]partInfo, error) {
+	if _, err := m.GetUpload(bucket, object, uploadID, initiator); err != nil {
+		return nil, err
+	}
+	matches, err := filepath.Glob(filepath.Join(m.uploadDir(uploadID), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]partInfo, 0, len(matches))
+	for _, match := range matches {
+		if filepath.Base(match) == multipartUploadJSON {
+			continue
+		}
+		part := partInfo{}
+		if err := readJSONFile(match, &part); err != nil {
+			continue
+		}
+		parts = append(parts, part)
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].PartNumber < parts[j].PartNumber
+	})
+	return parts, nil
+}
+
+//ListUploads 返回桶内 initiator 发起的未完成分片上传, 按 key、创建时间排序
+func (m *MultipartStore) ListUploads(bucket, prefix, initiator string) ([]multipartUpload, error) {
+	entries, err := ioutil.ReadDir(m.dir)
+	if err != nil {
+		return nil, err
+	}
+	var uploads []multipartUpload
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasSuffix(entry.Name(), multipartCompleteFlag) {
+			continue
+		}
+		upload := multipartUpload{}
+		if err := readJSONFile(filepath.Join(m.dir, entry.Name(), multipartUploadJSON), &upload); err != nil {
+			continue
+		}
+		if upload.Bucket != bucket || upload.Initiator != initiator || !strings.HasPrefix(upload.Object, prefix) {
+			continue
+		}
+		uploads = append(uploads, upload)
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		if uploads[i].Object != uploads[j].Object {
+			return uploads[i].Object < uploads[j].Object
+		}
+		return uploads[i].Initiated.Before(uploads[j].Initiated)
+	})
+	return uploads, nil
+}
+
+//Abort 删除分片上传及所有分片
+func (m *MultipartStore) Abort(bucket, object, uploadID, initiator string) error {
+	if _, err := m.GetUpload(bucket, object, uploadID, initiator); err != nil {
+		return err
+	}
+	return os.RemoveAll(m.uploadDir(uploadID))
+}
+
+//CleanupLoop 定期删除过期的上传, 不返回
+func (m *MultipartStore) CleanupLoop() {
+	interval := m.expiry / 4
+	if interval > maxMultipartCleanupInterval {
+		interval = maxMultipartCleanupInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		m.removeExpired()
+	}
+}
+
+//removeExpired 删除创建时间超过 expiry 的上传, 以及合并中断(进程退出)后遗留的目录
+func (m *MultipartStore) removeExpired() {
+	entries, err := ioutil.ReadDir(m.dir)
+	if err != nil {
+		logger.Error("list multipart uploads error:%s", err.Error())
+		return
+	}
+	deadline := time.Now().Add(-m.expiry)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		name := filepath.Join(m.dir, entry.Name())
+		if strings.HasSuffix(entry.Name(), multipartCompleteFlag) {
+			if entry.ModTime().After(deadline) {
+				continue
+			}
+		} else {
+			upload := multipartUpload{}
+			//upload.json 不存在或损坏时按目录修改时间判断
+			initiated := entry.ModTime()
+			if err := readJSONFile(filepath.Join(name, multipartUploadJSON), &upload); err == nil {
+				initiated = upload.Initiated
+			}
+			if initiated.After(deadline) {
+				continue
+			}
+		}
+		if err := os.RemoveAll(name); err != nil {
+			logger.Error("remove expired multipart upload %s error:%s", entry.Name(), err.Error())
+			continue
+		}
+		logger.Info("removed expired multipart upload %s", entry.Name())
+	}
+}
+
+// multipartCompletion 合并中的分片上传
+type multipartCompletion struct {
+	store    *MultipartStore
+	dir      string
+	uploadID string
+	Upload   multipartUpload
+	Parts    []partInfo
+	Size     int64
+	ETag     etag.ETag
+}
+
+//Complete 校验客户端提交的分片列表, 返回可读取合并后数据的 multipartCompletion.
+//合并期间 uploadId 对其他请求不可见, 调用方需要根据结果调用 Commit 或 Rollback.
+func (m *MultipartStore) Complete(bucket, object, uploadID, initiator string, parts []mxml.CompletePart) (*multipartCompletion, error) {
+	upload, err := m.GetUpload(bucket, object, uploadID, initiator)
+	if err != nil {
+		return nil, err
+	}
+	uploaded, err := m.ListParts(bucket, object, uploadID, initiator)
+	if err != nil {
+		return nil, err
+	}
+	uploadedParts := make(map[int]partInfo, len(uploaded))
+	for _, part := range uploaded {
+		uploadedParts[part.PartNumber] = part
+	}
+
+	c := &multipartCompletion{store: m, uploadID: uploadID, Upload: upload}
+	etags := make([]etag.ETag, 0, len(parts))
+	for i, p := range parts {
+		if i > 0 && p.PartNumber <= parts[i-1].PartNumber {
+			return nil, errInvalidPartOrder
+		}
+		part, ok := uploadedParts[p.PartNumber]
+		if !ok {
+			return nil, errInvalidPart
+		}
+		clientETag, err := etag.Parse(p.ETag)
+		if err != nil || clientETag.String() != part.ETag {
+			return nil, errInvalidPart
+		}
+		if i < len(parts)-1 && part.Size < globalMinPartSize {
+			return nil, errPartTooSmall
+		}
+		c.Parts = append(c.Parts, part)
+		c.Size += part.Size
+		etags = append(etags, clientETag)
+	}
+	if len(c.Parts) == 0 {
+		return nil, errInvalidPart
+	}
+	c.ETag = etag.Multipart(etags...)
+
+	c.dir = m.uploadDir(uploadID) + multipartCompleteFlag
+	if err := os.Rename(m.uploadDir(uploadID), c.dir); err != nil {
+		return nil, errUploadIDNotFound
+	}
+	//合并开始的时间, 清理遗留的合并目录时使用
+	now := time.Now()
+	os.Chtimes(c.dir, now, now)
+	return c, nil
+}
+
+//Reader 按顺序读取所有分片
+func (c *multipartCompletion) Reader() io.ReadCloser {
+	return &partsReader{dir: c.dir, parts: c.Parts}
+}
+
+//Commit 合并成功, 删除暂存数据
+func (c *multipartCompletion) Commit() {
+	os.RemoveAll(c.dir)
+}
+
+//Rollback 合并失败, 恢复 uploadId 以便客户端重试
+func (c *multipartCompletion) Rollback() {
+	os.Rename(c.dir, c.store.uploadDir(c.uploadID))
+}
+
+// partsReader 依次打开分片文件, 同一时间只持有一个文件句柄
+type partsReader struct {
+	dir     string
+	parts   []partInfo
+	current *os.File
+}
+
+func (r *partsReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.parts) == 0 {
+				return 0, io.EOF
+			}
+			fp, err := os.Open(filepath.Join(r.dir, partFile(r.parts[0].PartNumber)))
+			if err != nil {
+				return 0, err
+			}
+			r.current = fp
+			r.parts = r.parts[1:]
+		}
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *partsReader) Close() error {
+	if r.current != nil {
+		return r.current.Close()
+	}
+	return nil
+}
+
+func writeJSONFile(name string, v interface{}) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, buf, 0644)
+}
+
+func readJSONFile(name string, v interface{}) error {
+	buf, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, v)
+}
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	xhttp "s3Gateway/internal/http"
+)
+
+//GET/HEAD 对象的条件请求及 Range、partNumber 处理
+
+// objectRange 需要读取的对象范围
+type objectRange struct {
+	Offset int64
+	// Length 小于 0 表示读取整个对象
+	Length int64
+	// Partial 为 true 时返回 206 及 Content-Range
+	Partial bool
+	// PartsCount 按 partNumber 读取分片对象时返回 x-amz-mp-parts-count
+	PartsCount int
+}
+
+// conditionalHeaders 条件请求头名称, GET/HEAD 与复制源使用不同的请求头
+type conditionalHeaders struct {
+	IfMatch, IfUnmodifiedSince, IfNoneMatch, IfModifiedSince string
+}
+
+var (
+	objectConditionalHeaders     = conditionalHeaders{xhttp.IfMatch, xhttp.IfUnmodifiedSince, xhttp.IfNoneMatch, xhttp.IfModifiedSince}
+	copySourceConditionalHeaders = conditionalHeaders{xhttp.AmzCopySourceIfMatch, xhttp.AmzCopySourceIfUnmodifiedSince, xhttp.AmzCopySourceIfNoneMatch, xhttp.AmzCopySourceIfModifiedSince}
+)
+
+//evalPreconditions 按 RFC 7232 的顺序处理 If-Match、If-Unmodified-Since、If-None-Match、If-Modified-Since,
+//返回 http.StatusOK、http.StatusNotModified 或 http.StatusPreconditionFailed
+func evalPreconditions(header http.Header, names conditionalHeaders, objInfo ObjectInfo) int {
+	modTime := objInfo.ModTime.UTC().Truncate(time.Second)
+	if ifMatch := header.Get(names.IfMatch); ifMatch != "" {
+		if !etagMatches(objInfo.ETag, ifMatch) {
+			return http.StatusPreconditionFailed
+		}
+	} else if ifUnmodifiedSince := header.Get(names.IfUnmodifiedSince); ifUnmodifiedSince != "" && !objInfo.ModTime.IsZero() {
+		if t, err := http.ParseTime(ifUnmodifiedSince); err == nil && modTime.After(t) {
+			return http.StatusPreconditionFailed
+		}
+	}
+	if ifNoneMatch := header.Get(names.IfNoneMatch); ifNoneMatch != "" {
+		if etagMatches(objInfo.ETag, ifNoneMatch) {
+			return http.StatusNotModified
+		}
+	} else if ifModifiedSince := header.Get(names.IfModifiedSince); ifModifiedSince != "" && !objInfo.ModTime.IsZero() {
+		if t, err := http.ParseTime(ifModifiedSince); err == nil && !modTime.After(t) {
+			return http.StatusNotModified
+		}
+	}
+	return http.StatusOK
+}
+
+//checkPreconditions GET/HEAD 条件不满足时写入 304/412 响应并返回 true
+func checkPreconditions(ctx context.Context, w http.ResponseWriter, r *http.Request, objInfo ObjectInfo) bool {
+	switch evalPreconditions(r.Header, objectConditionalHeaders, objInfo) {
+	case http.StatusPreconditionFailed:
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrPreconditionFailed), r.URL, guessIsBrowserReq(r))
+		return true
+	case http.StatusNotModified:
+		writeNotModified(w, objInfo)
+		return true
+	}
+	return false
+}
+
+//checkCopyObjectPreconditions 复制源条件不满足时返回 412 并返回 true
+func checkCopyObjectPreconditions(ctx context.Context, w http.ResponseWriter, r *http.Request, srcInfo ObjectInfo) bool {
+	if evalPreconditions(r.Header, copySourceConditionalHeaders, srcInfo) != http.StatusOK {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrPreconditionFailed), r.URL, guessIsBrowserReq(r))
+		return true
+	}
+	return false
+}
+
+//etagMatches 判断 If-Match/If-None-Match 中是否包含对象的 ETag, 支持 "*" 及逗号分隔的多个值
+func etagMatches(objectETag, header string) bool {
+	for _, e := range strings.Split(header, ",") {
+		e = strings.TrimSpace(e)
+		if e == "*" || strings.Trim(strings.TrimPrefix(e, "W/"), "\"") == objectETag {
+			return true
+		}
+	}
+	return false
+}
+
+//writeNotModified 304 响应只返回 ETag 及 Last-Modified
+func writeNotModified(w http.ResponseWriter, objInfo ObjectInfo) {
+	if objInfo.ETag != "" {
+		w.Header().Set(xhttp.ETag, "\""+objInfo.ETag+"\"")
+	}
+	if !objInfo.ModTime.IsZero() {
+		w.Header().Set(xhttp.LastModified, objInfo.ModTime.UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusNotModified)
+}
+
+//getObjectRange 根据 partNumber 或 Range 请求头计算读取范围
+func getObjectRange(r *http.Request, objInfo ObjectInfo) (objectRange, APIErrorCode) {
+	rng := objectRange{Length: -1}
+	rangeHeader := r.Header.Get(xhttp.Range)
+	if partNumberStr := r.URL.Query().Get(xhttp.PartNumber); partNumberStr != "" {
+		if rangeHeader != "" {
+			return rng, ErrInvalidRangePartNumber
+		}
+		partNumber, err := strconv.Atoi(partNumberStr)
+		if err != nil || partNumber < 1 || partNumber > globalMaxPartID {
+			return rng, ErrInvalidPartNumber
+		}
+		//普通上传的对象只有一个分片
+		if len(objInfo.Parts) == 0 {
+			if partNumber != 1 {
+				return rng, ErrInvalidPartNumber
+			}
+			return rng, ErrNone
+		}
+		var offset int64
+		for _, part := range objInfo.Parts {
+			if part.Number == partNumber {
+				rng.Offset, rng.Length, rng.Partial = offset, part.Size, true
+				rng.PartsCount = len(objInfo.Parts)
+				return rng, ErrNone
+			}
+			offset += part.Size
+		}
+		return rng, ErrInvalidPartNumber
+	}
+	//对象大小未知时忽略 Range, 返回完整对象
+	if rangeHeader == "" || objInfo.Size < 0 {
+		return rng, ErrNone
+	}
+	rs, err := parseRequestRangeSpec(rangeHeader)
+	if err != nil {
+		if err == errInvalidRange {
+			return rng, ErrInvalidRange
+		}
+		//格式错误的 Range 按 RFC 7233 忽略
+		return rng, ErrNone
+	}
+	offset, length, err := rs.GetOffsetLength(objInfo.Size)
+	if err != nil || length == 0 {
+		return rng, ErrInvalidRange
+	}
+	rng.Offset, rng.Length, rng.Partial = offset, length, true
+	return rng, ErrNone
+}
+
+//setObjectRangeHeaders 写入对象响应头, 返回响应状态码
+func setObjectRangeHeaders(w http.ResponseWriter, objInfo ObjectInfo, rng objectRange) int {
+	setObjectHeaders(w, objInfo)
+	w.Header().Set(xhttp.AcceptRanges, "bytes")
+	if rng.PartsCount > 0 {
+		w.Header().Set(xhttp.AmzMpPartsCount, strconv.Itoa(rng.PartsCount))
+	}
+	if !rng.Partial {
+		return http.StatusOK
+	}
+	w.Header().Set(xhttp.ContentLength, strconv.FormatInt(rng.Length, 10))
+	w.Header().Set(xhttp.ContentRange, fmt.Sprintf("bytes %d-%d/%d", rng.Offset, rng.Offset+rng.Length-1, objInfo.Size))
+	return http.StatusPartialContent
+}
+
+//writeObjectRangeError 范围无效时返回 416 并带上对象大小
+func writeObjectRangeError(ctx context.Context, w http.ResponseWriter, r *http.Request, objInfo ObjectInfo, errCode APIErrorCode) {
+	if errCode == ErrInvalidRange {
+		w.Header().Set(xhttp.ContentRange, fmt.Sprintf("bytes */%d", objInfo.Size))
+	}
+	WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(errCode), r.URL, guessIsBrowserReq(r))
+}
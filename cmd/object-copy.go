@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/minio/minio-go/v7/pkg/s3utils"
+	"s3Gateway/internal/auth"
+	xhttp "s3Gateway/internal/http"
+	mxml "s3Gateway/model/xml"
+)
+
+//服务端复制: CopyObject 及 UploadPartCopy
+
+const (
+	metadataDirectiveCopy    = "COPY"
+	metadataDirectiveReplace = "REPLACE"
+)
+
+//CopyObject PUT /{bucket}/{object} x-amz-copy-source: /{srcBucket}/{srcObject}
+func (o *Object) CopyObject(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiCopyObject)
+	params := mux.Vars(r)
+	//复制源使用同一个已校验签名的身份鉴权, 签名只校验一次
+	reqCred, _, _, s3Error := validateSignature(ctx, getRequestAuthType(r), r)
+	if s3Error != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	cred, s3Error := checkRequestPolicies(ctx, r, apiActions[apiCopyObject], params["bucket"], params["object"], reqCred)
+	if s3Error != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if err := SetKey(ctx, cred); err != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	srcBucket, srcObject, s3Error := parseCopySource(r.Header.Get(xhttp.AmzCopySource))
+	if s3Error != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if s3Error := checkCopySource(r, srcBucket, srcObject, reqCred, cred); s3Error != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	directive := r.Header.Get(xhttp.AmzMetadataDirective)
+	if directive != "" && directive != metadataDirectiveCopy && directive != metadataDirectiveReplace {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrInvalidMetadataDirective), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	//复制到自身时必须替换元数据, 否则没有意义
+	if srcBucket == params["bucket"] && srcObject == params["object"] && directive != metadataDirectiveReplace {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrInvalidCopyDest), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	srcInfo, err := o.Backend.HeadObject(ctx, srcBucket, srcObject)
+	if err != nil {
+		WriteErrorResponse(ctx, w, err, r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if checkCopyObjectPreconditions(ctx, w, r, srcInfo) {
+		return
+	}
+	opts := ObjectOptions{UserDefined: objectMetadata(srcInfo)}
+	if directive == metadataDirectiveReplace {
+		if opts.UserDefined, s3Error = extractMetadata(r.Header); s3Error != ErrNone {
+			WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
+			return
+		}
+	}
+	objInfo, err := o.Backend.CopyObject(ctx, srcBucket, srcObject, params["bucket"], params["object"], opts)
+	if err != nil {
+		WriteErrorResponse(ctx, w, err, r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if objInfo.ModTime.IsZero() {
+		objInfo.ModTime = time.Now()
+	}
+	response := mxml.CopyObjectResult{
+		Xmlns:        s3Namespace,
+		LastModified: objInfo.ModTime.UTC(),
+		ETag:         "\"" + objInfo.ETag + "\"",
+	}
+	WriteSuccessResponseXML(w, EncodeResponse(response))
+}
+
+//CopyObjectPart PUT /{bucket}/{object}?partNumber={partNumber}&uploadId={uploadId} x-amz-copy-source: /{srcBucket}/{srcObject}
+func (o *Object) CopyObjectPart(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiCopyObjectPart)
+	params := mux.Vars(r)
+	reqCred, _, _, s3Error := validateSignature(ctx, getRequestAuthType(r), r)
+	if s3Error != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	cred, s3Error := checkRequestPolicies(ctx, r, apiActions[apiCopyObjectPart], params["bucket"], params["object"], reqCred)
+	if s3Error != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if err := SetKey(ctx, cred); err != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	partNumber, err := strconv.Atoi(r.URL.Query().Get(xhttp.PartNumber))
+	if err != nil || partNumber < 1 {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrInvalidPart), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if partNumber > globalMaxPartID {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrInvalidMaxParts), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	uploadID := r.URL.Query().Get(xhttp.UploadID)
+	if _, err := o.Multipart.GetUpload(params["bucket"], params["object"], uploadID, cred.AccessKey); err != nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(toAPIErrorCode(ctx, err)), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	srcBucket, srcObject, s3Error := parseCopySource(r.Header.Get(xhttp.AmzCopySource))
+	if s3Error != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if s3Error := checkCopySource(r, srcBucket, srcObject, reqCred, cred); s3Error != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	srcInfo, s3Err := o.Backend.HeadObject(ctx, srcBucket, srcObject)
+	if s3Err != nil {
+		WriteErrorResponse(ctx, w, s3Err, r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if checkCopyObjectPreconditions(ctx, w, r, srcInfo) {
+		return
+	}
+	offset, length := int64(0), srcInfo.Size
+	if rangeHeader := r.Header.Get(xhttp.AmzCopySourceRange); rangeHeader != "" {
+		if offset, length, s3Error = parseCopyPartRange(rangeHeader, srcInfo.Size); s3Error != ErrNone {
+			WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
+			return
+		}
+	}
+	reader, _, s3Err := o.Backend.GetObject(ctx, srcBucket, srcObject, offset, length)
+	if s3Err != nil {
+		WriteErrorResponse(ctx, w, s3Err, r.URL, guessIsBrowserReq(r))
+		return
+	}
+	defer reader.Close()
+	part, err := o.Multipart.PutPart(params["bucket"], params["object"], uploadID, cred.AccessKey, partNumber, reader, length)
+	if err != nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(toAPIErrorCode(ctx, err)), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	response := mxml.CopyObjectPartResult{
+		Xmlns:        s3Namespace,
+		LastModified: part.ModTime,
+		ETag:         "\"" + part.ETag + "\"",
+	}
+	WriteSuccessResponseXML(w, EncodeResponse(response))
+}
+
+//checkCopySource 复制源需要读权限, reqCred 为请求签名的身份, cred 为访问目标使用的身份
+//后端读写使用同一个身份, 匿名请求的源桶与目标桶 owner 不同时拒绝
+func checkCopySource(r *http.Request, srcBucket, srcObject string, reqCred, cred auth.Credentials) APIErrorCode {
+	srcCred, s3Error := checkCopySourcePolicies(r, srcBucket, srcObject, reqCred)
+	if s3Error != ErrNone {
+		return s3Error
+	}
+	if srcCred.AccessKey != cred.AccessKey {
+		return ErrAccessDenied
+	}
+	return ErrNone
+}
+
+//parseCopySource 解析 x-amz-copy-source: [/]{bucket}/{object}[?versionId=xxx], 网关不支持多版本, versionId 忽略
+func parseCopySource(copySource string) (bucket, object string, errCode APIErrorCode) {
+	if i := strings.Index(copySource, "?"); i >= 0 {
+		copySource = copySource[:i]
+	}
+	copySource, err := url.PathUnescape(copySource)
+	if err != nil {
+		return "", "", ErrInvalidCopySource
+	}
+	copySource = strings.TrimPrefix(copySource, SlashSeparator)
+	i := strings.Index(copySource, SlashSeparator)
+	if i <= 0 || i == len(copySource)-1 {
+		return "", "", ErrInvalidCopySource
+	}
+	bucket, object = copySource[:i], copySource[i+1:]
+	if s3utils.CheckValidBucketName(bucket) != nil || s3utils.CheckValidObjectName(object) != nil {
+		return "", "", ErrInvalidCopySource
+	}
+	return bucket, object, ErrNone
+}
+
+//parseCopyPartRange 解析 x-amz-copy-source-range, 只支持 bytes=first-last 格式
+func parseCopyPartRange(rangeString string, size int64) (offset, length int64, errCode APIErrorCode) {
+	rs, err := parseRequestRangeSpec(rangeString)
+	if err != nil || rs.IsSuffixLength || rs.End == -1 {
+		return 0, 0, ErrInvalidCopyPartRange
+	}
+	if size >= 0 && rs.End >= size {
+		return 0, 0, ErrInvalidCopyPartRangeSource
+	}
+	return rs.Start, rs.End - rs.Start + 1, ErrNone
+}
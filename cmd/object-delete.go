@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/minio/minio-go/v7/pkg/s3utils"
+	"s3Gateway/internal/auth"
+	"s3Gateway/internal/etag"
+	mxml "s3Gateway/model/xml"
+)
+
+const (
+	// maxDeleteList 单次 DeleteObjects 最多删除的对象数
+	maxDeleteList = 1000
+	// maxDeleteBody DeleteObjects 请求体上限 2MiB
+	maxDeleteBody = 2 << 20
+	// deleteObjectsConcurrency 同时向存储后端发起的删除请求数
+	deleteObjectsConcurrency = 16
+)
+
+//DeleteMultipleObjects POST /{bucket}?delete
+func (o *Object) DeleteMultipleObjects(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiDeleteMultipleObjects)
+	params := mux.Vars(r)
+	//签名只校验一次, 每个对象分别按策略鉴权
+	reqCred, _, _, s3Error := validateSignature(ctx, getRequestAuthType(r), r)
+	if s3Error != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	//s3 要求 DeleteObjects 必须携带 Content-MD5
+	if _, ok := r.Header["Content-Md5"]; !ok {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrMissingContentMD5), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	clientETag, err := etag.FromContentMD5(r.Header)
+	if err != nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrInvalidDigest), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxDeleteBody+1))
+	if err != nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(toAPIErrorCode(ctx, err)), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if len(body) > maxDeleteBody {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrEntityTooLarge), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if sum := md5.Sum(body); !bytes.Equal(sum[:], clientETag) {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrBadDigest), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	deleteObjects := mxml.DeleteObjectsRequest{}
+	if err := xml.Unmarshal(body, &deleteObjects); err != nil || len(deleteObjects.Objects) > maxDeleteList {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrMalformedXML), r.URL, guessIsBrowserReq(r))
+		return
+	}
+
+	//按请求顺序保存每个对象的删除结果
+	errs := make([]*APIError, len(deleteObjects.Objects))
+	//策略可能拒绝桶内部分前缀, 每个对象单独鉴权, 拒绝的对象在结果中返回 AccessDenied
+	allowed := make([]bool, len(deleteObjects.Objects))
+	var cred auth.Credentials
+	for i, object := range deleteObjects.Objects {
+		if s3utils.CheckValidObjectName(object.Key) != nil {
+			errs[i] = errorCodes.ToAPIErr(ErrInvalidObjectName)
+			continue
+		}
+		keyCred, s3Err := checkRequestPolicies(ctx, r, apiActions[apiDeleteMultipleObjects], params["bucket"], object.Key, reqCred)
+		if s3Err != ErrNone {
+			errs[i] = errorCodes.ToAPIErr(s3Err)
+			continue
+		}
+		//同一个桶内访问后端使用的身份相同
+		cred = keyCred
+		allowed[i] = true
+	}
+	if cred.AccessKey != "" {
+		if err := SetKey(ctx, cred); err != ErrNone {
+			WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(err), r.URL, guessIsBrowserReq(r))
+			return
+		}
+		if s3Err := o.Backend.HeadBucket(ctx, params["bucket"]); s3Err != nil {
+			WriteErrorResponse(ctx, w, s3Err, r.URL, guessIsBrowserReq(r))
+			return
+		}
+	}
+
+	sem := make(chan struct{}, deleteObjectsConcurrency)
+	var wg sync.WaitGroup
+	for i, object := range deleteObjects.Objects {
+		if !allowed[i] {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, key string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if s3Err := o.Backend.DeleteObject(ctx, params["bucket"], key); s3Err != nil && s3Err.Code != "NoSuchKey" {
+				errs[i] = s3Err
+			}
+		}(i, object.Key)
+	}
+	wg.Wait()
+
+	response := mxml.DeleteObjectsResponse{Xmlns: s3Namespace}
+	for i, object := range deleteObjects.Objects {
+		if errs[i] != nil {
+			response.Errors = append(response.Errors, mxml.DeleteError{
+				Key:       object.Key,
+				VersionID: object.VersionID,
+				Code:      errs[i].Code,
+				Message:   errs[i].Description,
+			})
+			continue
+		}
+		//Quiet 模式只返回删除失败的对象
+		if !deleteObjects.Quiet {
+			response.DeletedObjects = append(response.DeletedObjects, mxml.DeletedObject{
+				Key:       object.Key,
+				VersionID: object.VersionID,
+			})
+		}
+	}
+	WriteSuccessResponseXML(w, EncodeResponse(response))
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+//open_api 后端对象的网关侧元数据, open api 的上传接口没有元数据参数, 不能保存 Content-Type、x-amz-meta-* 等元数据
+//<dir>/<bucket>/<sha256(object)>.json 记录上传时的元数据、分片上传合并的 ETag 及分片信息, 与桶策略一样保存在 store.dir
+//对象被其他途径覆盖后存储后端返回的大小与记录不一致, 此时忽略记录
+
+const objectMetaSuffix = ".json"
+
+// objectMeta 对象元数据
+type objectMeta struct {
+	Size        int64             `json:"size"`
+	ETag        string            `json:"etag,omitempty"`
+	UserDefined map[string]string `json:"meta,omitempty"`
+	Parts       []ObjectPartInfo  `json:"parts,omitempty"`
+}
+
+// ObjectMetaStore 对象元数据存储
+type ObjectMetaStore struct {
+	dir string
+}
+
+func NewObjectMetaStore(dir string) (*ObjectMetaStore, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &ObjectMetaStore{dir: dir}, nil
+}
+
+//objectPath 对象名可能包含任意字符及 /, 文件名使用对象名的 sha256
+func (s *ObjectMetaStore) objectPath(bucket, object string) string {
+	sum := sha256.Sum256([]byte(object))
+	return filepath.Join(s.dir, bucket, hex.EncodeToString(sum[:])+objectMetaSuffix)
+}
+
+//Get 返回对象元数据, 没有记录时 ok 为 false
+func (s *ObjectMetaStore) Get(bucket, object string) (meta objectMeta, ok bool, err error) {
+	buf, err := ioutil.ReadFile(s.objectPath(bucket, object))
+	if os.IsNotExist(err) {
+		return meta, false, nil
+	}
+	if err != nil {
+		return meta, false, err
+	}
+	if err := json.Unmarshal(buf, &meta); err != nil {
+		return meta, false, errors.New("corrupted object metadata " + path.Join(bucket, object))
+	}
+	return meta, true, nil
+}
+
+//Set 保存对象元数据, 先写临时文件再重命名, 同一对象并发写入时以最后完成的为准
+func (s *ObjectMetaStore) Set(bucket, object string, meta objectMeta) error {
+	buf, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(s.dir, bucket)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(buf)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.objectPath(bucket, object))
+}
+
+//Delete 删除对象元数据, 记录不存在时不报错
+func (s *ObjectMetaStore) Delete(bucket, object string) error {
+	if err := os.Remove(s.objectPath(bucket, object)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+//DeleteBucket 删除桶后调用, 删除桶下全部对象的元数据
+func (s *ObjectMetaStore) DeleteBucket(bucket string) error {
+	return os.RemoveAll(filepath.Join(s.dir, bucket))
+}
@@ -0,0 +1,312 @@
+package cmd
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	xhttp "s3Gateway/internal/http"
+	mxml "s3Gateway/model/xml"
+)
+
+//分片上传相关接口
+
+const (
+	maxPartsList          = 1000
+	maxUploadsList        = 1000
+	maxCompleteUploadBody = 2 << 20 // CompleteMultipartUpload 请求体上限 2MiB
+)
+
+//NewMultipartUpload POST /{bucket}/{object}?uploads
+func (o *Object) NewMultipartUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiNewMultipartUpload)
+	params := mux.Vars(r)
+	cred, s3Error := checkRequestAuthType(ctx, r, apiActions[apiNewMultipartUpload], params["bucket"], params["object"])
+	if s3Error != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if err := SetKey(ctx, cred); err != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if s3Err := checkObjectName(params["object"]); s3Err != nil {
+		WriteErrorResponse(ctx, w, s3Err, r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if s3Err := o.Backend.HeadBucket(ctx, params["bucket"]); s3Err != nil {
+		WriteErrorResponse(ctx, w, s3Err, r.URL, guessIsBrowserReq(r))
+		return
+	}
+	metadata, s3Error := extractMetadata(r.Header)
+	if s3Error != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	uploadID, err := o.Multipart.NewUpload(params["bucket"], params["object"], cred.AccessKey, metadata)
+	if err != nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(toAPIErrorCode(ctx, err)), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	response := mxml.InitiateMultipartUploadResult{
+		Xmlns:    s3Namespace,
+		Bucket:   params["bucket"],
+		Key:      params["object"],
+		UploadID: uploadID,
+	}
+	WriteSuccessResponseXML(w, EncodeResponse(response))
+}
+
+//PutObjectPart PUT /{bucket}/{object}?partNumber={partNumber}&uploadId={uploadId}
+func (o *Object) PutObjectPart(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiPutObjectPart)
+	params := mux.Vars(r)
+	partNumber, err := strconv.Atoi(r.URL.Query().Get(xhttp.PartNumber))
+	if err != nil || partNumber < 1 {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrInvalidPart), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if partNumber > globalMaxPartID {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrInvalidMaxParts), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	body, size, cred, s3Err := newPutObjectReader(ctx, r, apiActions[apiPutObjectPart], params["bucket"], params["object"])
+	if s3Err != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	part, err := o.Multipart.PutPart(params["bucket"], params["object"], r.URL.Query().Get(xhttp.UploadID), cred.AccessKey, partNumber, body, size)
+	if body.err != nil {
+		err = body.err
+	}
+	if err != nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(toAPIErrorCode(ctx, err)), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	w.Header().Set(xhttp.ETag, "\""+part.ETag+"\"")
+	WriteSuccessResponseHeadersOnly(w)
+}
+
+//CompleteMultipartUpload POST /{bucket}/{object}?uploadId={uploadId}
+func (o *Object) CompleteMultipartUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiCompleteMultipartUpload)
+	params := mux.Vars(r)
+	cred, s3Error := checkRequestAuthType(ctx, r, apiActions[apiCompleteMultipartUpload], params["bucket"], params["object"])
+	if s3Error != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if err := SetKey(ctx, cred); err != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	complete := mxml.CompleteMultipartUpload{}
+	if err := xml.NewDecoder(io.LimitReader(r.Body, maxCompleteUploadBody)).Decode(&complete); err != nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrMalformedXML), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if len(complete.Parts) == 0 {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrMalformedXML), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	completion, err := o.Multipart.Complete(params["bucket"], params["object"], r.URL.Query().Get(xhttp.UploadID), cred.AccessKey, complete.Parts)
+	if err != nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(toAPIErrorCode(ctx, err)), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	reader := completion.Reader()
+	opts := ObjectOptions{
+		UserDefined: completion.Upload.UserDefined,
+		ETag:        completion.ETag.String(),
+	}
+	for _, part := range completion.Parts {
+		opts.Parts = append(opts.Parts, ObjectPartInfo{Number: part.PartNumber, Size: part.Size})
+	}
+	_, s3Err := o.Backend.PutObject(ctx, params["bucket"], params["object"], reader, completion.Size, opts)
+	reader.Close()
+	if s3Err != nil {
+		completion.Rollback()
+		WriteErrorResponse(ctx, w, s3Err, r.URL, guessIsBrowserReq(r))
+		return
+	}
+	completion.Commit()
+	response := mxml.CompleteMultipartUploadResult{
+		Xmlns:    s3Namespace,
+		Location: getObjectLocation(r, params["bucket"], params["object"]),
+		Bucket:   params["bucket"],
+		Key:      params["object"],
+		ETag:     "\"" + completion.ETag.String() + "\"",
+	}
+	WriteSuccessResponseXML(w, EncodeResponse(response))
+}
+
+//AbortMultipartUpload DELETE /{bucket}/{object}?uploadId={uploadId}
+func (o *Object) AbortMultipartUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiAbortMultipartUpload)
+	params := mux.Vars(r)
+	cred, s3Error := checkRequestAuthType(ctx, r, apiActions[apiAbortMultipartUpload], params["bucket"], params["object"])
+	if s3Error != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if err := SetKey(ctx, cred); err != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if err := o.Multipart.Abort(params["bucket"], params["object"], r.URL.Query().Get(xhttp.UploadID), cred.AccessKey); err != nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(toAPIErrorCode(ctx, err)), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	WriteSuccessNoContent(w)
+}
+
+//ListObjectParts GET /{bucket}/{object}?uploadId={uploadId}
+func (o *Object) ListObjectParts(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiListObjectParts)
+	params := mux.Vars(r)
+	cred, s3Error := checkRequestAuthType(ctx, r, apiActions[apiListObjectParts], params["bucket"], params["object"])
+	if s3Error != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if err := SetKey(ctx, cred); err != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	query := r.URL.Query()
+	maxParts := maxPartsList
+	if v := query.Get("max-parts"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrInvalidMaxParts), r.URL, guessIsBrowserReq(r))
+			return
+		}
+		if n < maxParts {
+			maxParts = n
+		}
+	}
+	partNumberMarker := 0
+	if v := query.Get("part-number-marker"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrInvalidPartNumberMarker), r.URL, guessIsBrowserReq(r))
+			return
+		}
+		partNumberMarker = n
+	}
+	uploadID := query.Get(xhttp.UploadID)
+	upload, err := o.Multipart.GetUpload(params["bucket"], params["object"], uploadID, cred.AccessKey)
+	if err != nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(toAPIErrorCode(ctx, err)), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	parts, err := o.Multipart.ListParts(params["bucket"], params["object"], uploadID, cred.AccessKey)
+	if err != nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(toAPIErrorCode(ctx, err)), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	response := mxml.ListPartsResult{
+		Xmlns:            s3Namespace,
+		Bucket:           params["bucket"],
+		Key:              params["object"],
+		UploadID:         uploadID,
+		Initiator:        mxml.Initiator{ID: upload.Initiator, DisplayName: upload.Initiator},
+		Owner:            mxml.Initiator{ID: upload.Initiator, DisplayName: upload.Initiator},
+		StorageClass:     "STANDARD",
+		PartNumberMarker: partNumberMarker,
+		MaxParts:         maxParts,
+	}
+	for _, part := range parts {
+		if part.PartNumber <= partNumberMarker {
+			continue
+		}
+		if len(response.Parts) == maxParts {
+			response.IsTruncated = true
+			break
+		}
+		response.Parts = append(response.Parts, mxml.Part{
+			PartNumber:   part.PartNumber,
+			LastModified: part.ModTime,
+			ETag:         "\"" + part.ETag + "\"",
+			Size:         part.Size,
+		})
+		response.NextPartNumberMarker = part.PartNumber
+	}
+	WriteSuccessResponseXML(w, EncodeResponse(response))
+}
+
+//ListMultipartUploads GET /{bucket}?uploads
+func (o *Object) ListMultipartUploads(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiListMultipartUploads)
+	params := mux.Vars(r)
+	cred, s3Error := checkRequestAuthType(ctx, r, apiActions[apiListMultipartUploads], params["bucket"], "")
+	if s3Error != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if err := SetKey(ctx, cred); err != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	query := r.URL.Query()
+	maxUploads := maxUploadsList
+	if v := query.Get("max-uploads"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrInvalidMaxUploads), r.URL, guessIsBrowserReq(r))
+			return
+		}
+		if n < maxUploads {
+			maxUploads = n
+		}
+	}
+	if s3Err := o.Backend.HeadBucket(ctx, params["bucket"]); s3Err != nil {
+		WriteErrorResponse(ctx, w, s3Err, r.URL, guessIsBrowserReq(r))
+		return
+	}
+	prefix, keyMarker, uploadIDMarker := query.Get("prefix"), query.Get("key-marker"), query.Get("upload-id-marker")
+	uploads, err := o.Multipart.ListUploads(params["bucket"], prefix, cred.AccessKey)
+	if err != nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(toAPIErrorCode(ctx, err)), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	response := mxml.ListMultipartUploadsResult{
+		Xmlns:          s3Namespace,
+		Bucket:         params["bucket"],
+		KeyMarker:      keyMarker,
+		UploadIDMarker: uploadIDMarker,
+		Prefix:         prefix,
+		MaxUploads:     maxUploads,
+	}
+	//key-marker 之前的上传全部跳过; 与 key-marker 相同的 key, 没有 upload-id-marker 时全部跳过,
+	//否则跳过到 upload-id-marker (含) 为止, 之后的上传继续返回
+	afterMarker := false
+	for _, upload := range uploads {
+		if upload.Object < keyMarker {
+			continue
+		}
+		if upload.Object == keyMarker && keyMarker != "" && !afterMarker {
+			if uploadIDMarker != "" && upload.UploadID == uploadIDMarker {
+				afterMarker = true
+			}
+			continue
+		}
+		if len(response.Uploads) == maxUploads {
+			response.IsTruncated = true
+			break
+		}
+		response.Uploads = append(response.Uploads, mxml.Upload{
+			Key:          upload.Object,
+			UploadID:     upload.UploadID,
+			Initiator:    mxml.Initiator{ID: upload.Initiator, DisplayName: upload.Initiator},
+			Owner:        mxml.Initiator{ID: upload.Initiator, DisplayName: upload.Initiator},
+			StorageClass: "STANDARD",
+			Initiated:    upload.Initiated,
+		})
+		response.NextKeyMarker = upload.Object
+		response.NextUploadIDMarker = upload.UploadID
+	}
+	WriteSuccessResponseXML(w, EncodeResponse(response))
+}
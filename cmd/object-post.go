@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/minio/minio-go/v7/pkg/s3utils"
+	"s3Gateway/internal/auth"
+	xhttp "s3Gateway/internal/http"
+	"s3Gateway/internal/logger"
+	mxml "s3Gateway/model/xml"
+)
+
+//浏览器表单上传: POST /{bucket}, multipart/form-data
+//整个表单先由 ReadForm 读取: 普通字段放在内存中, 文件内容超出 maxFormMemory 的部分写入临时文件, 字段顺序不限
+//policy 由签名保证不被篡改
+
+const (
+	// maxFormMemory 表单解析时放在内存中的上限, 超出部分(文件内容)写入临时文件
+	maxFormMemory = 4 << 20
+	// maxPostObjectSize 表单上传的对象大小上限, 与单次 PutObject 一致
+	maxPostObjectSize = 5 << 30
+)
+
+//PostObject POST /{bucket}
+func (o *Object) PostObject(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiPostObject)
+	params := mux.Vars(r)
+	bucket := params["bucket"]
+	if r.ContentLength > maxPostObjectSize+maxFormMemory {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrEntityTooLarge), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	//未声明 Content-Length 时同样限制读取的数据量
+	r.Body = http.MaxBytesReader(w, r.Body, maxPostObjectSize+maxFormMemory)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErrWithErr(ErrMalformedPOSTRequest, err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	form, err := reader.ReadForm(maxFormMemory)
+	if err != nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErrWithErr(ErrMalformedPOSTRequest, err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	defer form.RemoveAll()
+
+	fileBody, fileName, fileSize, formValues, err := extractPostPolicyFormValues(form)
+	if errors.Is(err, errPostFileFieldTooLarge) {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrEntityTooLarge), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if err != nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErrWithErr(ErrMalformedPOSTRequest, err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if fileBody == nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrPOSTFileRequired), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	defer fileBody.Close()
+
+	formValues.Set("Bucket", bucket)
+	//key 中的 ${filename} 替换为上传文件名
+	if fileName != "" && strings.Contains(formValues.Get("Key"), "${filename}") {
+		formValues.Set("Key", strings.Replace(formValues.Get("Key"), "${filename}", fileName, -1))
+	}
+	object := trimLeadingSlash(formValues.Get("Key"))
+	if object == "" {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErrWithErr(ErrMissingFields, errors.New("key is required")), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if s3utils.CheckValidObjectName(object) != nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrInvalidObjectName), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if reqInfo, ok := GetReqInfo(ctx); ok {
+		reqInfo.ObjectName = object
+	}
+
+	successRedirect := formValues.Get("Success_action_redirect")
+	if successRedirect == "" {
+		successRedirect = formValues.Get("Redirect")
+	}
+	var redirectURL *url.URL
+	if successRedirect != "" {
+		if redirectURL, err = url.Parse(successRedirect); err != nil {
+			WriteErrorResponse(ctx, w, errorCodes.ToAPIErrWithErr(ErrMalformedPOSTRequest, err), r.URL, guessIsBrowserReq(r))
+			return
+		}
+	}
+
+	//未携带签名及 policy 的表单按匿名请求处理, 由桶策略决定是否允许上传
+	var cred auth.Credentials
+	_, signedV2 := formValues[xhttp.AmzSignatureV2]
+	_, signedV4 := formValues[xhttp.AmzSignature]
+	if signedV2 || signedV4 || formValues.Get("Policy") != "" {
+		if formValues.Get("Policy") == "" {
+			WriteErrorResponse(ctx, w, errorCodes.ToAPIErrWithErr(ErrMissingFields, errors.New("policy is required")), r.URL, guessIsBrowserReq(r))
+			return
+		}
+		var s3Err APIErrorCode
+		if cred, s3Err = doesPolicySignatureMatch(formValues); s3Err != ErrNone {
+			WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Err), r.URL, guessIsBrowserReq(r))
+			return
+		}
+		policyBytes, err := base64.StdEncoding.DecodeString(formValues.Get("Policy"))
+		if err != nil {
+			WriteErrorResponse(ctx, w, errorCodes.ToAPIErrWithErr(ErrMalformedPOSTRequest, err), r.URL, guessIsBrowserReq(r))
+			return
+		}
+		postPolicyForm, err := parsePostPolicyForm(string(policyBytes))
+		if err != nil {
+			WriteErrorResponse(ctx, w, errorCodes.ToAPIErrWithErr(ErrPostPolicyConditionInvalidFormat, err), r.URL, guessIsBrowserReq(r))
+			return
+		}
+		if err = checkPostPolicy(formValues, postPolicyForm); err != nil {
+			WriteErrorResponse(ctx, w, errorCodes.ToAPIErrWithErr(ErrAccessDenied, err), r.URL, guessIsBrowserReq(r))
+			return
+		}
+		if lengthRange := postPolicyForm.Conditions.ContentLengthRange; lengthRange.Valid {
+			if fileSize < lengthRange.Min {
+				WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrEntityTooSmall), r.URL, guessIsBrowserReq(r))
+				return
+			}
+			if fileSize > lengthRange.Max {
+				WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrEntityTooLarge), r.URL, guessIsBrowserReq(r))
+				return
+			}
+		}
+	}
+	if fileSize > maxPostObjectSize {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrEntityTooLarge), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	cred, s3Err := checkRequestPolicies(ctx, r, apiActions[apiPostObject], bucket, object, cred)
+	if s3Err != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if err := SetKey(ctx, cred); err != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+
+	metadata, s3Err := extractMetadata(formValues)
+	if s3Err != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	objInfo, apiErr := o.Backend.PutObject(ctx, bucket, object, fileBody, fileSize, ObjectOptions{UserDefined: metadata})
+	if apiErr != nil {
+		WriteErrorResponse(ctx, w, apiErr, r.URL, guessIsBrowserReq(r))
+		return
+	}
+
+	location := getObjectLocation(r, bucket, object)
+	if objInfo.ETag != "" {
+		w.Header().Set(xhttp.ETag, "\""+objInfo.ETag+"\"")
+	}
+	w.Header().Set(xhttp.Location, location)
+	if redirectURL != nil {
+		//重定向地址追加 bucket/key/etag 查询参数
+		query := redirectURL.Query()
+		query.Set("bucket", bucket)
+		query.Set("key", object)
+		query.Set("etag", "\""+objInfo.ETag+"\"")
+		redirectURL.RawQuery = query.Encode()
+		WriteRedirectSeeOther(w, redirectURL.String())
+		return
+	}
+	//success_action_status 默认 204
+	switch formValues.Get("Success_action_status") {
+	case "201":
+		response := mxml.PostResponse{
+			Bucket:   bucket,
+			Key:      object,
+			ETag:     "\"" + objInfo.ETag + "\"",
+			Location: location,
+		}
+		WriteResponse(w, http.StatusCreated, EncodeResponse(response), mimeXML)
+	case "200":
+		WriteSuccessResponseHeadersOnly(w)
+	default:
+		WriteSuccessNoContent(w)
+	}
+}
+
+//extractPostPolicyFormValues 表单字段名统一为规范格式, 返回上传的文件内容、文件名及大小
+func extractPostPolicyFormValues(form *multipart.Form) (filePart io.ReadCloser, fileName string, fileSize int64, formValues http.Header, err error) {
+	formValues = make(http.Header)
+	for k, v := range form.Value {
+		formValues[http.CanonicalHeaderKey(k)] = v
+	}
+	//file 字段未指定 filename 时被当作普通字段解析, 内容在内存中, 大小不能超过 maxFormMemory
+	if len(form.File) == 0 {
+		if v, ok := formValues["File"]; ok {
+			size := 0
+			for _, s := range v {
+				size += len(s)
+			}
+			if size > maxFormMemory {
+				return nil, "", 0, nil, errPostFileFieldTooLarge
+			}
+			b := bytes.NewBufferString(strings.Join(v, ""))
+			delete(formValues, "File")
+			return ioutil.NopCloser(b), "", int64(b.Len()), formValues, nil
+		}
+		return nil, "", 0, formValues, nil
+	}
+	for k, v := range form.File {
+		if http.CanonicalHeaderKey(k) != "File" || len(v) == 0 {
+			continue
+		}
+		fileHeader := v[0]
+		if filePart, err = fileHeader.Open(); err != nil {
+			logger.Error("open post form file error:%s", err.Error())
+			return nil, "", 0, nil, err
+		}
+		return filePart, fileHeader.Filename, fileHeader.Size, formValues, nil
+	}
+	return nil, "", 0, formValues, nil
+}
@@ -1,27 +1,31 @@
 package cmd
 
 import (
-	"encoding/xml"
+	"context"
+	"encoding/base64"
 	"github.com/gorilla/mux"
 	"github.com/minio/pkg/bucket/policy"
 	"io"
-	"log"
+	"io/ioutil"
 	"net/http"
-	"net/http/httputil"
+	"s3Gateway/internal/auth"
 	"s3Gateway/internal/etag"
+	"s3Gateway/internal/hash"
 	xhttp "s3Gateway/internal/http"
 	mxml "s3Gateway/model/xml"
 	"strconv"
 	"strings"
 )
 
-type Object struct{}
+type Object struct {
+	Backend   Backend
+	Multipart *MultipartStore
+}
 
-func (*Object) Head(w http.ResponseWriter, r *http.Request) {
-	ctx := newContext(r, w, "head-object")
+func (o *Object) Head(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiHeadObject)
 	params := mux.Vars(r)
-	log.Println(params)
-	if cred, s3Error := checkRequestAuthType(ctx, r, policy.GetObjectAction, params["bucket"], params["object"]); s3Error != ErrNone {
+	if cred, s3Error := checkRequestAuthType(ctx, r, apiActions[apiHeadObject], params["bucket"], params["object"]); s3Error != ErrNone {
 		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
 		return
 	} else {
@@ -30,22 +34,26 @@ func (*Object) Head(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
-	headFile, err := HeadFile(ctx)
+	objInfo, err := o.Backend.HeadObject(ctx, params["bucket"], params["object"])
 	if err != nil {
 		WriteErrorResponse(ctx, w, err, r.URL, guessIsBrowserReq(r))
 		return
 	}
-	for k, v := range headFile.Data.Header {
-		w.Header().Set(k, v)
+	if checkPreconditions(ctx, w, r, objInfo) {
+		return
 	}
-	WriteSuccessResponseHeadersOnly(w)
+	rng, s3Error := getObjectRange(r, objInfo)
+	if s3Error != ErrNone {
+		writeObjectRangeError(ctx, w, r, objInfo, s3Error)
+		return
+	}
+	w.WriteHeader(setObjectRangeHeaders(w, objInfo, rng))
 }
 
-func (*Object) Get(w http.ResponseWriter, r *http.Request) {
-	ctx := newContext(r, w, "head-object")
+func (o *Object) Get(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiGetObject)
 	params := mux.Vars(r)
-	log.Println(params)
-	if cred, s3Error := checkRequestAuthType(ctx, r, policy.GetObjectAction, params["bucket"], params["object"]); s3Error != ErrNone {
+	if cred, s3Error := checkRequestAuthType(ctx, r, apiActions[apiGetObject], params["bucket"], params["object"]); s3Error != ErrNone {
 		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
 		return
 	} else {
@@ -54,18 +62,45 @@ func (*Object) Get(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
-	m, err := GetCid(ctx)
+	objInfo, err := o.Backend.HeadObject(ctx, params["bucket"], params["object"])
 	if err != nil {
 		WriteErrorResponse(ctx, w, err, r.URL, guessIsBrowserReq(r))
 		return
 	}
-	rep, err := DownloadFile(ctx, m.Data.StoreHost, m.Data.Cid)
-	if err != nil {
-		WriteErrorResponse(ctx, w, err, r.URL, guessIsBrowserReq(r))
+	if checkPreconditions(ctx, w, r, objInfo) {
+		return
+	}
+	var reader io.ReadCloser
+	//HeadObject 没有返回大小时先下载完整对象, 使用下载响应中的大小, 仍然未知时不返回 Content-Length
+	if objInfo.Size < 0 {
+		var info ObjectInfo
+		if reader, info, err = o.Backend.GetObject(ctx, params["bucket"], params["object"], 0, -1); err != nil {
+			WriteErrorResponse(ctx, w, err, r.URL, guessIsBrowserReq(r))
+			return
+		}
+		defer reader.Close()
+		objInfo.Size = info.Size
+	}
+	rng, s3Error := getObjectRange(r, objInfo)
+	if s3Error != ErrNone {
+		writeObjectRangeError(ctx, w, r, objInfo, s3Error)
 		return
 	}
-	defer rep.Body.Close()
+	if reader == nil {
+		if reader, _, err = o.Backend.GetObject(ctx, params["bucket"], params["object"], rng.Offset, rng.Length); err != nil {
+			WriteErrorResponse(ctx, w, err, r.URL, guessIsBrowserReq(r))
+			return
+		}
+		defer reader.Close()
+	} else if rng.Partial {
+		if _, err := io.CopyN(ioutil.Discard, reader, rng.Offset); err != nil {
+			WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrInvalidRange), r.URL, guessIsBrowserReq(r))
+			return
+		}
+		reader = readCloser{io.LimitReader(reader, rng.Length), reader}
+	}
 
+	statusCode := setObjectRangeHeaders(w, objInfo, rng)
 	writerHeader := w.Header()
 	for k, v := range r.URL.Query() {
 		if len(v) < 1 {
@@ -73,98 +108,178 @@ func (*Object) Get(w http.ResponseWriter, r *http.Request) {
 		}
 		if strings.HasPrefix(k, "response-") {
 			headerName := strings.TrimPrefix(k, "response-")
-			writerHeader.Add(strings.ToUpper(headerName[:1])+headerName[1:], v[0])
+			writerHeader.Set(strings.ToUpper(headerName[:1])+headerName[1:], v[0])
 		}
 	}
-	for k, vs := range rep.Header {
-		for _, v := range vs {
-			writerHeader.Add(k, v)
-		}
-	}
-	io.Copy(w, rep.Body)
+	w.WriteHeader(statusCode)
+	io.Copy(w, reader)
 }
-func (*Object) Put(w http.ResponseWriter, r *http.Request) {
 
-	ctx := newContext(r, w, "head-object")
-	if cred, _, _, _, err := calculateSeedSignature(r); err != ErrNone {
-		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(err), r.URL, guessIsBrowserReq(r))
+func (o *Object) Put(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiPutObject)
+	params := mux.Vars(r)
+	body, size, _, s3Err := newPutObjectReader(ctx, r, apiActions[apiPutObject], params["bucket"], params["object"])
+	if s3Err != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	metadata, s3Err := extractMetadata(r.Header)
+	if s3Err != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	opts := ObjectOptions{UserDefined: metadata}
+	objInfo, errCode := o.Backend.PutObject(ctx, params["bucket"], params["object"], body, size, opts)
+	if body.err != nil {
+		//读取请求体失败(签名/摘要不匹配等)优先于后端返回的错误
+		errCode = errorCodes.ToAPIErr(toAPIErrorCode(ctx, body.err))
+	}
+	if errCode != nil {
+		WriteErrorResponse(ctx, w, errCode, r.URL, guessIsBrowserReq(r))
 		return
-	} else {
-		if err := SetKey(ctx, cred); err != ErrNone {
-			WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(err), r.URL, guessIsBrowserReq(r))
-			return
-		}
 	}
+	if objInfo.ETag != "" {
+		w.Header().Set(xhttp.ETag, "\""+objInfo.ETag+"\"")
+	}
+	WriteSuccessResponseHeadersOnly(w)
+}
 
-	_, err := etag.FromContentMD5(r.Header)
+//newPutObjectReader 校验上传请求的签名, 返回解码后的请求体、数据长度及访问存储后端使用的身份
+func newPutObjectReader(ctx context.Context, r *http.Request, action policy.Action, bucket, object string) (*errRecorderReader, int64, auth.Credentials, APIErrorCode) {
+	clientETag, err := etag.FromContentMD5(r.Header)
 	if err != nil {
-		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrInvalidDigest), r.URL, guessIsBrowserReq(r))
-		return
+		return nil, 0, auth.Credentials{}, ErrInvalidDigest
 	}
 	size := r.ContentLength
 	rAuthType := getRequestAuthType(r)
 	if rAuthType == authTypeStreamingSigned {
 		if sizeStr, ok := r.Header[xhttp.AmzDecodedContentLength]; ok {
 			if sizeStr[0] == "" {
-				WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrMissingContentLength), r.URL, guessIsBrowserReq(r))
-				return
+				return nil, 0, auth.Credentials{}, ErrMissingContentLength
 			}
 			size, err = strconv.ParseInt(sizeStr[0], 10, 64)
 			if err != nil {
-				WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrInvalidDigest), r.URL, guessIsBrowserReq(r))
-				return
+				return nil, 0, auth.Credentials{}, ErrInvalidDigest
 			}
 		}
 	}
 	if size == -1 {
-		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrMissingContentLength), r.URL, guessIsBrowserReq(r))
-		return
+		return nil, 0, auth.Credentials{}, ErrMissingContentLength
 	}
 
-	chuncek := httputil.NewChunkedReader(r.Body)
-	re, errCode := FileUpdateCredential(ctx)
-	if errCode != nil {
-		WriteErrorResponse(ctx, w, errCode, r.URL, guessIsBrowserReq(r))
+	var reader io.Reader
+	var cred auth.Credentials
+	var s3Err APIErrorCode
+	switch rAuthType {
+	case authTypeStreamingSigned:
+		//逐个校验 chunk 签名, 解码后的数据才交给后端
+		chunkReader, chunkCred, s3Err := newSignV4ChunkedReader(r)
+		if s3Err != ErrNone {
+			return nil, 0, auth.Credentials{}, s3Err
+		}
+		if cred, s3Err = checkRequestPolicies(ctx, r, action, bucket, object, chunkCred); s3Err != ErrNone {
+			return nil, 0, auth.Credentials{}, s3Err
+		}
+		if s3Err = SetKey(ctx, cred); s3Err != ErrNone {
+			return nil, 0, auth.Credentials{}, s3Err
+		}
+		hashReader, err := hash.NewReader(chunkReader, -1, clientETag.String(), "", -1)
+		if err != nil {
+			return nil, 0, auth.Credentials{}, toAPIErrorCode(ctx, err)
+		}
+		reader = hashReader
+	default:
+		if cred, s3Err = checkRequestAuthType(ctx, r, action, bucket, object); s3Err != ErrNone {
+			return nil, 0, auth.Credentials{}, s3Err
+		}
+		if s3Err = SetKey(ctx, cred); s3Err != ErrNone {
+			return nil, 0, auth.Credentials{}, s3Err
+		}
+		reader = r.Body
+		//v4 签名及预签名校验签名时 r.Body 已包装为校验 Content-Md5 及 X-Amz-Content-Sha256 的 reader
+		//v2 签名、预签名及匿名请求的 r.Body 未包装, 在这里校验 Content-Md5
+		if rAuthType != authTypeSigned && rAuthType != authTypePresigned {
+			hashReader, err := hash.NewReader(r.Body, -1, clientETag.String(), "", -1)
+			if err != nil {
+				return nil, 0, auth.Credentials{}, toAPIErrorCode(ctx, err)
+			}
+			reader = hashReader
+		}
+	}
+	return &errRecorderReader{Reader: reader}, size, cred, ErrNone
+}
+
+//ListV1 GET /{bucket}
+func (o *Object) ListV1(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiListObjectsV1)
+	params := mux.Vars(r)
+	cred, s3Error := checkRequestAuthType(ctx, r, apiActions[apiListObjectsV1], params["bucket"], "")
+	if s3Error != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
 		return
 	}
-	_, errCode = FileUpdate(ctx, chuncek, re, size)
-	if errCode != nil {
-		WriteErrorResponse(ctx, w, errCode, r.URL, guessIsBrowserReq(r))
+	if err := SetKey(ctx, cred); err != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(err), r.URL, guessIsBrowserReq(r))
 		return
 	}
-	WriteSuccessResponseHeadersOnly(w)
+	prefix, marker, delimiter, maxKeys, encodingType, s3Error := getListObjectsV1Args(r.URL.Query())
+	if s3Error != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	objects, err := o.Backend.ListObjects(ctx, params["bucket"], prefix)
+	if err != nil {
+		WriteErrorResponse(ctx, w, err, r.URL, guessIsBrowserReq(r))
+		return
+	}
+	info := listObjects(objects, prefix, marker, delimiter, maxKeys)
+	owner := &mxml.ListObjectResultContentOwner{ID: cred.AccessKey, DisplayName: cred.AccessKey}
+	response := generateListObjectsV1Response(params["bucket"], prefix, marker, delimiter, encodingType, maxKeys, info, owner)
+	WriteSuccessResponseXML(w, EncodeResponse(response))
 }
 
-func (*Object) ListV1(w http.ResponseWriter, r *http.Request) {
-	ctx := newContext(r, w, "head-object")
+//ListV2 GET /{bucket}?list-type=2
+func (o *Object) ListV2(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiListObjectsV2)
 	params := mux.Vars(r)
-	log.Println(params)
-	if cred, s3Error := checkRequestAuthType(ctx, r, policy.GetObjectAction, params["bucket"], params["object"]); s3Error != ErrNone {
+	cred, s3Error := checkRequestAuthType(ctx, r, apiActions[apiListObjectsV2], params["bucket"], "")
+	if s3Error != ErrNone {
 		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
 		return
-	} else {
-		if err := SetKey(ctx, cred); err != ErrNone {
-			WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(err), r.URL, guessIsBrowserReq(r))
-			return
-		}
 	}
-	out, err := ListFile(ctx)
+	if err := SetKey(ctx, cred); err != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	prefix, token, startAfter, delimiter, fetchOwner, maxKeys, encodingType, s3Error := getListObjectsV2Args(r.URL.Query())
+	if s3Error != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	//continuation-token 优先于 start-after
+	marker := startAfter
+	if token != "" {
+		decoded, _ := base64.StdEncoding.DecodeString(token)
+		marker = string(decoded)
+	}
+	objects, err := o.Backend.ListObjects(ctx, params["bucket"], prefix)
 	if err != nil {
 		WriteErrorResponse(ctx, w, err, r.URL, guessIsBrowserReq(r))
 		return
 	}
-	response := mxml.ListObjectResult{}
-	decoder := xml.NewDecoder(strings.NewReader(out.Data.Data))
-	if err := decoder.Decode(&response); err != nil {
-		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrMalformedXML), r.URL, guessIsBrowserReq(r))
+	info := listObjects(objects, prefix, marker, delimiter, maxKeys)
+	var owner *mxml.ListObjectResultContentOwner
+	if fetchOwner {
+		owner = &mxml.ListObjectResultContentOwner{ID: cred.AccessKey, DisplayName: cred.AccessKey}
 	}
+	response := generateListObjectsV2Response(params["bucket"], prefix, token, startAfter, delimiter, encodingType, maxKeys, info, owner)
 	WriteSuccessResponseXML(w, EncodeResponse(response))
 }
-func (*Object) Delete(w http.ResponseWriter, r *http.Request) {
-	ctx := newContext(r, w, "head-object")
+
+func (o *Object) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiDeleteObject)
 	params := mux.Vars(r)
-	log.Println(params)
-	if cred, s3Error := checkRequestAuthType(ctx, r, policy.GetObjectAction, params["bucket"], params["object"]); s3Error != ErrNone {
+	if cred, s3Error := checkRequestAuthType(ctx, r, apiActions[apiDeleteObject], params["bucket"], params["object"]); s3Error != ErrNone {
 		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Error), r.URL, guessIsBrowserReq(r))
 		return
 	} else {
@@ -173,7 +288,7 @@ func (*Object) Delete(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
-	if err := DelFile(ctx); err != nil {
+	if err := o.Backend.DeleteObject(ctx, params["bucket"], params["object"]); err != nil {
 		WriteErrorResponse(ctx, w, err, r.URL, guessIsBrowserReq(r))
 		return
 	}
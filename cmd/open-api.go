@@ -9,11 +9,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"math/rand"
 	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"net/url"
+	xhttp "s3Gateway/internal/http"
 	mjson "s3Gateway/model/json"
 	"sort"
 	"strconv"
@@ -45,10 +46,27 @@ type MetaData struct {
 	//header
 	Header map[string][]string
 	//body
-	Body   io.Reader
+	Body io.Reader
+	//body 长度, 流式上传时使用
+	ContentLength int64
+	//client 为空时使用 openApiClient
+	Client *http.Client
 	secret string
 }
 
+var (
+	//openApiClient 普通接口请求
+	openApiClient = &http.Client{Timeout: 10 * time.Second}
+	//streamClient 上传下载文件, 耗时与文件大小相关, 不设置整体超时
+	streamClient = &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			ResponseHeaderTimeout: 10 * time.Minute,
+			IdleConnTimeout:       90 * time.Second,
+		},
+	}
+)
+
 func NewMetAData(targetUrl, appId, secret string) *MetaData {
 	d := &MetaData{
 		Url:    targetUrl,
@@ -61,7 +79,10 @@ func NewMetAData(targetUrl, appId, secret string) *MetaData {
 	d.Header["User-Agent"] = append(d.Header["User-Agent"], "chrome")
 	return d
 }
-func DoRequest(method string, metaData *MetaData) (*http.Response, error) {
+
+//DoRequest 请求 openApi, ctx 中有请求信息时通过 x-amz-request-id 头传递 request id, 便于关联两端的日志
+//耗时(至收到响应头)累计到请求信息中, 记录在访问日志, 同时按路径记录监控指标
+func DoRequest(ctx context.Context, method string, metaData *MetaData) (*http.Response, error) {
 	var req *http.Request
 	var err error
 	if method == http.MethodGet {
@@ -72,11 +93,18 @@ func DoRequest(method string, metaData *MetaData) (*http.Response, error) {
 	if err != nil {
 		return nil, err
 	}
+	if metaData.ContentLength > 0 {
+		req.ContentLength = metaData.ContentLength
+	}
 	for key, value := range metaData.Header {
 		for _, v := range value {
 			req.Header.Add(key, v)
 		}
 	}
+	reqInfo, ok := GetReqInfo(ctx)
+	if ok && reqInfo.RequestID != "" {
+		req.Header.Set(xhttp.AmzRequestID, reqInfo.RequestID)
+	}
 	//签名
 	nonce := RandomNonce()
 	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
@@ -86,8 +114,18 @@ func DoRequest(method string, metaData *MetaData) (*http.Response, error) {
 	signature.Add("nonce", nonce)
 	signature.Add("timestamp", timestamp)
 	req.Header.Add("Signature", signature.Encode())
-	http.DefaultClient.Timeout = 10 * time.Second
-	response, err := http.DefaultClient.Do(req)
+	client := metaData.Client
+	if client == nil {
+		client = openApiClient
+	}
+	start := time.Now()
+	response, err := client.Do(req)
+	duration := time.Since(start)
+	if ok {
+		reqInfo.addBackendLatency(duration)
+	}
+	//201 上传成功、206 按 Range 下载等 2xx 响应不计为错误
+	recordOpenApiMetrics(req.URL.Path, duration, err != nil || response.StatusCode >= http.StatusMultipleChoices)
 	if err != nil {
 		return nil, err
 	}
@@ -105,11 +143,12 @@ func StatusOk(response *http.Response) APIErrorCode {
 //UserSecret s3 查询用户 ak
 func UserSecret(ak string) (*mjson.CompanySecret, error) {
 	x := fmt.Sprintf("%s/%s", GlobalConfig.OpenApi.Host, GlobalConfig.OpenApi.Paths.SecretByAppid)
-	meta := NewMetAData(x, "bingheyun2", "896f669fc2ba4f31961fb76157a54d9f")
+	id := getGatewayIdentity()
+	meta := NewMetAData(x, id.AppId, id.Secret)
 	data := url.Values{}
 	data.Set("app_id", ak)
 	meta.Body = strings.NewReader(data.Encode())
-	rep, err := DoRequest(http.MethodPost, meta)
+	rep, err := DoRequest(context.Background(), http.MethodPost, meta)
 	if err != nil {
 		return nil, err
 	}
@@ -122,14 +161,14 @@ func UserSecret(ak string) (*mjson.CompanySecret, error) {
 	if err := csDecoder.Decode(&cs); err != nil {
 		return nil, err
 	}
-	if cs.Code != 0 {
-		return nil, errors.New(cs.Msg)
+	if cs.Code != 0 || cs.Data == "" {
+		return nil, fmt.Errorf("%w: %s", errNoSuchUser, cs.Msg)
 	}
 	return &cs, nil
 }
 
 //ListFile 文件列表
-func ListFile(ctx context.Context) (*mjson.ListFile, *APIError) {
+func ListFile(ctx context.Context, bucket, prefix string) (*mjson.ListFile, *APIError) {
 	reqInfo, ok := GetReqInfo(ctx)
 	if !ok {
 		return nil, errorCodes.ToAPIErr(ErrAuthHeaderEmpty)
@@ -137,9 +176,12 @@ func ListFile(ctx context.Context) (*mjson.ListFile, *APIError) {
 	meta := NewMetAData(fmt.Sprintf("%s/%s", GlobalConfig.OpenApi.Host, GlobalConfig.OpenApi.Paths.ListFile), reqInfo.AccessKey, reqInfo.SecretKey)
 
 	v := url.Values{}
-	v.Add("bucket_name", reqInfo.BucketName)
+	v.Add("bucket_name", bucket)
+	if prefix != "" {
+		v.Add("prefix", prefix)
+	}
 	meta.Body = strings.NewReader(v.Encode())
-	rep, err := DoRequest(http.MethodPost, meta)
+	rep, err := DoRequest(ctx, http.MethodPost, meta)
 	if err != nil {
 		return nil, errorCodes.ToAPIErr(ErrBusy)
 	}
@@ -163,31 +205,40 @@ func ListFile(ctx context.Context) (*mjson.ListFile, *APIError) {
 }
 
 //DownloadFile 文件下载
-func DownloadFile(ctx context.Context, storeHost, cid string) (*http.Response, *APIError) {
+func DownloadFile(ctx context.Context, storeHost, cid, bucket, object, byteRange string) (*http.Response, *APIError) {
 	reqInfo, ok := GetReqInfo(ctx)
 	if !ok {
 		return nil, errorCodes.ToAPIErr(ErrAuthHeaderEmpty)
 	}
 	meta := NewMetAData(fmt.Sprintf("%s/%s", storeHost, GlobalConfig.OpenApi.Paths.DownloadFile), reqInfo.AccessKey, reqInfo.SecretKey)
 	meta.Header["from"] = append(meta.Header["from"], "s3")
+	meta.Client = streamClient
 	v := url.Values{}
 	v.Add("cid", cid)
-	v.Add("bucket_name", reqInfo.BucketName)
-	v.Add("key", reqInfo.ObjectName)
+	v.Add("bucket_name", bucket)
+	v.Add("key", object)
 	meta.Url = fmt.Sprintf("%s?%s", meta.Url, v.Encode())
+	//存储节点支持 Range 时返回 206, 否则返回完整数据由调用方截取
+	if byteRange != "" {
+		meta.Header["Range"] = append(meta.Header["Range"], byteRange)
+	}
 
-	rep, err := DoRequest(http.MethodGet, meta)
+	rep, err := DoRequest(ctx, http.MethodGet, meta)
 	if err != nil {
 		return nil, errorCodes.ToAPIErr(ErrBusy)
 	}
+	if byteRange != "" && rep.StatusCode == http.StatusPartialContent {
+		return rep, nil
+	}
 	if errCode := StatusOk(rep); errCode != ErrNone {
+		rep.Body.Close()
 		return nil, errorCodes.ToAPIErr(errCode)
 	}
 	return rep, nil
 }
 
 //FileUpdateCredential 文件上传
-func FileUpdateCredential(ctx context.Context) (*mjson.UploadCredential, *APIError) {
+func FileUpdateCredential(ctx context.Context, bucket, object string) (*mjson.UploadCredential, *APIError) {
 	reqInfo, ok := GetReqInfo(ctx)
 	if !ok {
 		return nil, errorCodes.ToAPIErr(ErrAuthHeaderEmpty)
@@ -196,11 +247,11 @@ func FileUpdateCredential(ctx context.Context) (*mjson.UploadCredential, *APIErr
 	meta := NewMetAData(x, reqInfo.AccessKey, reqInfo.SecretKey)
 	meta.Header["form"] = append(meta.Header["from"], "s3")
 	data := url.Values{}
-	data.Set("bucket_name", reqInfo.BucketName)
-	data.Set("key", reqInfo.ObjectName)
+	data.Set("bucket_name", bucket)
+	data.Set("key", object)
 
 	meta.Body = strings.NewReader(data.Encode())
-	rep, err := DoRequest(http.MethodPost, meta)
+	rep, err := DoRequest(ctx, http.MethodPost, meta)
 	if err != nil {
 		return nil, errorCodes.ToAPIErr(ErrBusy)
 	}
@@ -224,43 +275,78 @@ func FileUpdateCredential(ctx context.Context) (*mjson.UploadCredential, *APIErr
 		HTTPStatusCode: credential.Data.HttpStatus,
 	}
 }
-func FileUpdate(ctx context.Context, file io.Reader, credential *mjson.UploadCredential, fileSize int64) (*mjson.UploadFile, *APIError) {
+func FileUpdate(ctx context.Context, file io.Reader, credential *mjson.UploadCredential, bucket, object string, fileSize int64, contentType string) (*mjson.UploadFile, *APIError) {
 	reqInfo, ok := GetReqInfo(ctx)
 	if !ok {
 		return nil, errorCodes.ToAPIErr(ErrAuthHeaderEmpty)
 	}
+	//FileSize 及 Content-Length 需要准确的文件大小
+	if fileSize < 0 {
+		return nil, errorCodes.ToAPIErr(ErrInternalError)
+	}
 	x := fmt.Sprintf("%s/%s", credential.Data.StoreHost, GlobalConfig.OpenApi.Paths.UploadFile)
 	meta := NewMetAData(x, reqInfo.AccessKey, reqInfo.SecretKey)
 	meta.Header["Credential"] = []string{credential.Data.Credential}
 	meta.Header["from"] = []string{"s3"}
 	meta.Header["EventId"] = []string{credential.Data.EventId}
-	meta.Header["BucketName"] = []string{reqInfo.BucketName}
-	meta.Header["FileName"] = []string{reqInfo.ObjectName}
-	meta.Header["key"] = []string{reqInfo.ObjectName}
+	meta.Header["BucketName"] = []string{bucket}
+	meta.Header["FileName"] = []string{object}
+	meta.Header["key"] = []string{object}
 	meta.Header["FileSize"] = []string{strconv.FormatInt(fileSize, 10)}
-	writer := bytes.NewBuffer(nil)
-	meta.Body = writer
-	body := multipart.NewWriter(writer)
-	meta.Header["Content-Type"] = []string{body.FormDataContentType()}
-	fp, err := body.CreateFormFile("file", reqInfo.ObjectName)
-	if err != nil {
-		return nil, errorCodes.ToAPIErr(ErrBusy)
-	}
-	if i, err := io.Copy(fp, file); err != nil {
+
+	//multipart/form-data 边界部分长度固定, 预先计算出完整的 Content-Length
+	head := bytes.NewBuffer(nil)
+	form := multipart.NewWriter(head)
+	partHeader := make(textproto.MIMEHeader)
+	partHeader.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, escapeQuotes(object)))
+	partHeader.Set("Content-Type", "application/octet-stream")
+	if contentType != "" {
+		partHeader.Set("Content-Type", contentType)
+	}
+	if _, err := form.CreatePart(partHeader); err != nil {
 		return nil, errorCodes.ToAPIErr(ErrBusy)
-	} else {
-		log.Println(i)
 	}
-	body.Close()
+	headLen := head.Len()
+	form.Close()
+	meta.ContentLength = int64(head.Len()) + fileSize
+	meta.Header["Content-Type"] = []string{form.FormDataContentType()}
+	meta.Client = streamClient
 
-	rep, err := DoRequest(http.MethodPost, meta)
+	//边读请求边写入表单, 内存占用与文件大小无关
+	pr, pw := io.Pipe()
+	meta.Body = pr
+	done := make(chan struct{})
+	//返回前关闭管道并等待协程退出, 调用方在返回后读取 file 记录的错误
+	defer func() {
+		pr.Close()
+		<-done
+	}()
+	go func() {
+		defer close(done)
+		if _, err := pw.Write(head.Bytes()[:headLen]); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		//读到 EOF 才会校验 chunk 签名及摘要
+		if n, err := io.Copy(pw, file); err != nil || n != fileSize {
+			if err == nil {
+				err = errSizeUnexpected
+			}
+			pw.CloseWithError(err)
+			return
+		}
+		_, err := pw.Write(head.Bytes()[headLen:])
+		pw.CloseWithError(err)
+	}()
+
+	rep, err := DoRequest(ctx, http.MethodPost, meta)
 	if err != nil {
 		return nil, errorCodes.ToAPIErr(ErrBusy)
 	}
+	defer rep.Body.Close()
 	if rep.StatusCode != http.StatusCreated {
 		return nil, errorCodes.ToAPIErr(ErrNoSuchBucket)
 	}
-	defer rep.Body.Close()
 	uploadDecoder := json.NewDecoder(rep.Body)
 	uf := mjson.UploadFile{}
 	if err := uploadDecoder.Decode(&uf); err != nil {
@@ -277,7 +363,7 @@ func FileUpdate(ctx context.Context, file io.Reader, credential *mjson.UploadCre
 }
 
 //DelFile 删除文件
-func DelFile(ctx context.Context) *APIError {
+func DelFile(ctx context.Context, bucket, object string) *APIError {
 	reqInfo, ok := GetReqInfo(ctx)
 	if !ok {
 		return errorCodes.ToAPIErr(ErrAuthHeaderEmpty)
@@ -285,10 +371,10 @@ func DelFile(ctx context.Context) *APIError {
 	meta := NewMetAData(fmt.Sprintf("%s/%s", GlobalConfig.OpenApi.Host, GlobalConfig.OpenApi.Paths.DeleteFile), reqInfo.AccessKey, reqInfo.SecretKey)
 
 	val := url.Values{}
-	val.Add("key", reqInfo.ObjectName)
-	val.Add("bucket_name", reqInfo.BucketName)
+	val.Add("key", object)
+	val.Add("bucket_name", bucket)
 	meta.Body = strings.NewReader(val.Encode())
-	rep, err := DoRequest(http.MethodPost, meta)
+	rep, err := DoRequest(ctx, http.MethodPost, meta)
 	if err != nil {
 		return errorCodes.ToAPIErr(ErrBusy)
 	}
@@ -310,7 +396,8 @@ func DelFile(ctx context.Context) *APIError {
 		HTTPStatusCode: m.Data.HttpStatus,
 	}
 }
-func HeadFile(ctx context.Context) (*mjson.HeadFile, *APIError) {
+
+func HeadFile(ctx context.Context, bucket, object string) (*mjson.HeadFile, *APIError) {
 	reqInfo, ok := GetReqInfo(ctx)
 	if !ok {
 		return nil, errorCodes.ToAPIErr(ErrAuthHeaderEmpty)
@@ -318,10 +405,10 @@ func HeadFile(ctx context.Context) (*mjson.HeadFile, *APIError) {
 	meta := NewMetAData(fmt.Sprintf("%s/%s", GlobalConfig.OpenApi.Host, GlobalConfig.OpenApi.Paths.HeadFile), reqInfo.AccessKey, reqInfo.SecretKey)
 	meta.Header["form"] = append(meta.Header["from"], "s3")
 	payload := url.Values{}
-	payload.Add("bucket_name", reqInfo.BucketName)
-	payload.Add("key", reqInfo.ObjectName)
+	payload.Add("bucket_name", bucket)
+	payload.Add("key", object)
 	meta.Body = strings.NewReader(payload.Encode())
-	rep, err := DoRequest(http.MethodPost, meta)
+	rep, err := DoRequest(ctx, http.MethodPost, meta)
 	if err != nil {
 		return nil, errorCodes.ToAPIErr(ErrBusy)
 	}
@@ -345,17 +432,17 @@ func HeadFile(ctx context.Context) (*mjson.HeadFile, *APIError) {
 }
 
 //GetCid 换取cid
-func GetCid(ctx context.Context) (*mjson.GetCid, *APIError) {
+func GetCid(ctx context.Context, bucket, object string) (*mjson.GetCid, *APIError) {
 	reqInfo, ok := GetReqInfo(ctx)
 	if !ok {
 		return nil, errorCodes.ToAPIErr(ErrAuthHeaderEmpty)
 	}
 	meta := NewMetAData(fmt.Sprintf("%s/%s", GlobalConfig.OpenApi.Host, GlobalConfig.OpenApi.Paths.GetCid), reqInfo.AccessKey, reqInfo.SecretKey)
 	payload := url.Values{}
-	payload.Add("bucket_name", reqInfo.BucketName)
-	payload.Add("key", reqInfo.ObjectName)
+	payload.Add("bucket_name", bucket)
+	payload.Add("key", object)
 	meta.Body = strings.NewReader(payload.Encode())
-	rep, err := DoRequest(http.MethodPost, meta)
+	rep, err := DoRequest(ctx, http.MethodPost, meta)
 	if err != nil {
 		return nil, errorCodes.ToAPIErr(ErrBusy)
 	}
@@ -374,17 +461,20 @@ func GetCid(ctx context.Context) (*mjson.GetCid, *APIError) {
 	return &m, nil
 }
 
-//CreateBucket 创建桶
-func CreateBucket(ctx context.Context) *APIError {
+//CreateBucket 创建桶, location 为空时不传
+func CreateBucket(ctx context.Context, bucket, location string) *APIError {
 	reqInfo, ok := GetReqInfo(ctx)
 	if !ok {
 		return errorCodes.ToAPIErr(ErrAuthHeaderEmpty)
 	}
 	meta := NewMetAData(fmt.Sprintf("%s/%s", GlobalConfig.OpenApi.Host, GlobalConfig.OpenApi.Paths.CreateBucket), reqInfo.AccessKey, reqInfo.SecretKey)
 	payload := url.Values{}
-	payload.Add("bucket_name", reqInfo.BucketName)
+	payload.Add("bucket_name", bucket)
+	if location != "" {
+		payload.Add("location", location)
+	}
 	meta.Body = strings.NewReader(payload.Encode())
-	rep, err := DoRequest(http.MethodPost, meta)
+	rep, err := DoRequest(ctx, http.MethodPost, meta)
 	if err != nil {
 		return errorCodes.ToAPIErr(ErrBusy)
 	}
@@ -408,16 +498,16 @@ func CreateBucket(ctx context.Context) *APIError {
 }
 
 //DelBucket 删除桶
-func DelBucket(ctx context.Context) *APIError {
+func DelBucket(ctx context.Context, bucket string) *APIError {
 	reqInfo, ok := GetReqInfo(ctx)
 	if !ok {
 		return errorCodes.ToAPIErr(ErrAuthHeaderEmpty)
 	}
 	meta := NewMetAData(fmt.Sprintf("%s/%s", GlobalConfig.OpenApi.Host, GlobalConfig.OpenApi.Paths.DeleteBucket), reqInfo.AccessKey, reqInfo.SecretKey)
 	payload := url.Values{}
-	payload.Add("bucket_name", reqInfo.BucketName)
+	payload.Add("bucket_name", bucket)
 	meta.Body = strings.NewReader(payload.Encode())
-	rep, err := DoRequest(http.MethodPost, meta)
+	rep, err := DoRequest(ctx, http.MethodPost, meta)
 	if err != nil {
 		return errorCodes.ToAPIErr(ErrBusy)
 	}
@@ -449,7 +539,7 @@ func ListBucket(ctx context.Context) (*mjson.ListBucket, *APIError) {
 	payload := url.Values{}
 	payload.Add("bucket_name", reqInfo.BucketName)
 	meta.Body = strings.NewReader(payload.Encode())
-	rep, err := DoRequest(http.MethodPost, meta)
+	rep, err := DoRequest(ctx, http.MethodPost, meta)
 	if err != nil {
 		return nil, errorCodes.ToAPIErr(ErrBusy)
 	}
@@ -472,34 +562,42 @@ func ListBucket(ctx context.Context) (*mjson.ListBucket, *APIError) {
 	}
 }
 
-func HeadBucket(ctx context.Context) *APIError {
+//HeadBucket 查询桶, 返回桶所在区域
+func HeadBucket(ctx context.Context, bucket string) (*mjson.HeadBucket, *APIError) {
 	reqInfo, ok := GetReqInfo(ctx)
 	if !ok {
-		return errorCodes.ToAPIErr(ErrAuthHeaderEmpty)
+		return nil, errorCodes.ToAPIErr(ErrAuthHeaderEmpty)
 	}
 	meta := NewMetAData(fmt.Sprintf("%s/%s", GlobalConfig.OpenApi.Host, GlobalConfig.OpenApi.Paths.HeadBucket), reqInfo.AccessKey, reqInfo.SecretKey)
 	payload := url.Values{}
-	payload.Add("bucket_name", reqInfo.BucketName)
+	payload.Add("bucket_name", bucket)
 	meta.Body = strings.NewReader(payload.Encode())
-	rep, err := DoRequest(http.MethodPost, meta)
+	rep, err := DoRequest(ctx, http.MethodPost, meta)
 	if err != nil {
-		return errorCodes.ToAPIErr(ErrBusy)
+		return nil, errorCodes.ToAPIErr(ErrBusy)
 	}
 	if errCode := StatusOk(rep); errCode != ErrNone {
-		return errorCodes.ToAPIErr(errCode)
+		return nil, errorCodes.ToAPIErr(errCode)
 	}
-	m := mjson.CreateBucket{}
+	m := mjson.HeadBucket{}
 	defer rep.Body.Close()
 	decoder := json.NewDecoder(rep.Body)
 	if err := decoder.Decode(&m); err != nil {
-		return errorCodes.ToAPIErr(ErrBusy)
+		return nil, errorCodes.ToAPIErr(ErrBusy)
 	}
 	if m.Code == 0 && m.Data.HttpStatus == http.StatusOK {
-		return nil
+		return &m, nil
 	}
-	return &APIError{
+	return nil, &APIError{
 		Code:           m.Data.Error.Code,
 		Description:    m.Data.Error.Message,
 		HTTPStatusCode: m.Data.HttpStatus,
 	}
 }
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+//escapeQuotes 与 mime/multipart 中 CreateFormFile 的文件名转义一致
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/s3utils"
+	xhttp "s3Gateway/internal/http"
+	"s3Gateway/pkg/signer"
+)
+
+//预签名 URL 生成接口, 请求需要签名, URL 使用调用者的凭证签名, 调用者需要拥有对应对象操作的权限
+//  POST {PresignPath} 请求体 {"method":"GET","bucket":"b","key":"k","expires":3600,
+//       "contentType":"text/plain","responseHeaders":{"response-content-disposition":"attachment"},"signatureVersion":"v4"}
+
+const (
+	// PresignPath 预签名接口路径, 需在桶路由之前注册
+	PresignPath = GatewayPathPrefix + "/presign/v1"
+	// presignDefaultExpiry 未指定 expires 时 URL 的有效期
+	presignDefaultExpiry = time.Hour
+	// maxPresignRequestSize 请求体上限
+	maxPresignRequestSize = 64 * 1024
+
+	presignSignatureV2 = "v2"
+	presignSignatureV4 = "v4"
+)
+
+// presignAPIs 可预签名的方法 -> 对应的 s3 接口
+var presignAPIs = map[string]string{
+	http.MethodGet:    apiGetObject,
+	http.MethodHead:   apiHeadObject,
+	http.MethodPut:    apiPutObject,
+	http.MethodDelete: apiDeleteObject,
+}
+
+// presignResponseHeaders GET/HEAD 可以覆盖的响应头
+var presignResponseHeaders = map[string]bool{
+	"response-cache-control":       true,
+	"response-content-disposition": true,
+	"response-content-encoding":    true,
+	"response-content-language":    true,
+	"response-content-type":        true,
+	"response-expires":             true,
+}
+
+type Presign struct{}
+
+type presignRequest struct {
+	Method string `json:"method"`
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	// Expires 有效期(秒), 为 0 时使用默认值
+	Expires         int64             `json:"expires"`
+	ContentType     string            `json:"contentType"`
+	ResponseHeaders map[string]string `json:"responseHeaders"`
+	// SignatureVersion v4(默认) 或 v2
+	SignatureVersion string `json:"signatureVersion"`
+}
+
+type presignResponse struct {
+	URL        string    `json:"url"`
+	Method     string    `json:"method"`
+	Expiration time.Time `json:"expiration"`
+	// Headers 使用 URL 时需要携带的请求头
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+//Handle POST {PresignPath}
+func (p *Presign) Handle(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiPresign)
+	cred, _, _, s3Err := validateSignature(ctx, getRequestAuthType(r), r)
+	if s3Err != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if cred.AccessKey == "" {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrAccessDenied), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	body, ok := readAdminBody(ctx, w, r, maxPresignRequestSize)
+	if !ok {
+		return
+	}
+	req := presignRequest{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErrWithErr(ErrInvalidRequest, err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	req.Method = strings.ToUpper(req.Method)
+	api, ok := presignAPIs[req.Method]
+	if !ok {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErrWithErr(ErrInvalidRequest, fmt.Errorf("unsupported method %q", req.Method)), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if s3utils.CheckValidBucketName(req.Bucket) != nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrInvalidBucketName), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if s3utils.CheckValidObjectName(req.Key) != nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrInvalidObjectName), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if reqInfo, ok := GetReqInfo(ctx); ok {
+		reqInfo.BucketName = req.Bucket
+		reqInfo.ObjectName = req.Key
+	}
+	//生成 URL 的调用者需要拥有对应的操作权限
+	parent, s3Err := checkRequestPolicies(ctx, r, apiActions[api], req.Bucket, req.Key, cred)
+	if s3Err != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if err := SetKey(ctx, parent); err != ErrNone {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+
+	expires := time.Duration(req.Expires) * time.Second
+	switch {
+	case req.Expires == 0:
+		expires = presignDefaultExpiry
+	case req.Expires < 0:
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrNegativeExpires), r.URL, guessIsBrowserReq(r))
+		return
+	case expires > signer.MaxPresignExpiry:
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrMaximumExpires), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	now := time.Now().UTC()
+	//临时凭证签名的 URL 不能晚于凭证本身失效
+	if cred.IsTemp() && now.Add(expires).After(cred.Expiration) {
+		expires = cred.Expiration.Sub(now).Truncate(time.Second)
+	}
+
+	u, err := url.Parse(getObjectLocation(r, req.Bucket, req.Key))
+	if err != nil {
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErrWithErr(ErrInvalidRequest, err), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	query := make(url.Values)
+	for k, v := range req.ResponseHeaders {
+		k = strings.ToLower(k)
+		if !presignResponseHeaders[k] || (req.Method != http.MethodGet && req.Method != http.MethodHead) {
+			WriteErrorResponse(ctx, w, errorCodes.ToAPIErrWithErr(ErrInvalidRequest, fmt.Errorf("unsupported response header override %q", k)), r.URL, guessIsBrowserReq(r))
+			return
+		}
+		query.Set(k, v)
+	}
+	u.RawQuery = query.Encode()
+	header := make(http.Header)
+	if req.ContentType != "" {
+		if req.Method != http.MethodPut {
+			WriteErrorResponse(ctx, w, errorCodes.ToAPIErrWithErr(ErrInvalidRequest, fmt.Errorf("contentType is only valid for %s", http.MethodPut)), r.URL, guessIsBrowserReq(r))
+			return
+		}
+		header.Set(xhttp.ContentType, req.ContentType)
+	}
+
+	signCred := signer.Credentials{AccessKey: cred.AccessKey, SecretKey: cred.SecretKey, SessionToken: cred.SessionToken}
+	response := presignResponse{Method: req.Method, Expiration: now.Add(expires)}
+	switch strings.ToLower(req.SignatureVersion) {
+	case "", presignSignatureV4:
+		response.URL = signer.PresignV4(req.Method, *u, serverRegion(), signCred, header, now, expires)
+	case presignSignatureV2:
+		response.URL = signer.PresignV2(req.Method, *u, signCred, header, response.Expiration)
+	default:
+		WriteErrorResponse(ctx, w, errorCodes.ToAPIErrWithErr(ErrInvalidRequest, fmt.Errorf("unsupported signature version %q", req.SignatureVersion)), r.URL, guessIsBrowserReq(r))
+		return
+	}
+	if len(header) > 0 {
+		response.Headers = map[string]string{xhttp.ContentType: req.ContentType}
+	}
+	writeAdminResponse(ctx, w, r, response)
+}
@@ -18,74 +18,38 @@
 package cmd
 
 import (
-	"crypto/hmac"
-	"crypto/sha1"
 	"crypto/subtle"
 	"encoding/base64"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	xhttp "s3Gateway/internal/http"
+	"s3Gateway/pkg/signer"
 
 	"s3Gateway/internal/auth"
 )
 
-// Whitelist resource list that will be used in query string for signature-V2 calculation.
-//
-// This list should be kept alphabetically sorted, do not hastily edit.
-var resourceList = []string{
-	"acl",
-	"cors",
-	"delete",
-	"encryption",
-	"legal-hold",
-	"lifecycle",
-	"location",
-	"logging",
-	"notification",
-	"partNumber",
-	"policy",
-	"requestPayment",
-	"response-cache-control",
-	"response-content-disposition",
-	"response-content-encoding",
-	"response-content-language",
-	"response-content-type",
-	"response-expires",
-	"retention",
-	"select",
-	"select-type",
-	"tagging",
-	"torrent",
-	"uploadId",
-	"uploads",
-	"versionId",
-	"versioning",
-	"versions",
-	"website",
-}
-
 // Signature and API related constants.
 const (
-	signV2Algorithm = "AWS"
+	signV2Algorithm = signer.SignV2Algorithm
 )
 
 // AWS S3 Signature V2 calculation rule is give here:
 // http://docs.aws.amazon.com/AmazonS3/latest/dev/RESTAuthentication.html#RESTAuthenticationStringToSign
 func doesPolicySignatureV2Match(formValues http.Header) (auth.Credentials, APIErrorCode) {
 	accessKey := formValues.Get(xhttp.AmzAccessKeyID)
-	cred, _, s3Err := checkKeyValid(accessKey)
+	cred, _, s3Err := checkKeyValid(accessKey, formValues.Get(xhttp.AmzSecurityToken))
 	if s3Err != ErrNone {
 		return cred, s3Err
 	}
 	policy := formValues.Get("Policy")
 	signature := formValues.Get(xhttp.AmzSignatureV2)
-	if !compareSignatureV2(signature, calculateSignatureV2(policy, cred.SecretKey)) {
+	if !compareSignatureV2(signature, signer.SignatureV2(policy, cred.SecretKey)) {
 		return cred, ErrSignatureDoesNotMatch
 	}
 	return cred, ErrNone
@@ -154,7 +118,7 @@ func doesPresignV2SignatureMatch(r *http.Request) APIErrorCode {
 		return ErrInvalidQueryParams
 	}
 
-	cred, _, s3Err := checkKeyValid(accessKey)
+	cred, _, s3Err := checkKeyValid(accessKey, getSessionToken(r))
 	if s3Err != ErrNone {
 		return s3Err
 	}
@@ -170,6 +134,7 @@ func doesPresignV2SignatureMatch(r *http.Request) APIErrorCode {
 		return ErrExpiredPresignRequest
 	}
 
+	encodedResource = getResource(encodedResource, r.Host, GlobalConfig.Http.Domains)
 	expectedSignature := preSignatureV2(cred, r.Method, encodedResource, strings.Join(filteredQueries, "&"), r.Header, expires)
 	if !compareSignatureV2(gotSignature, expectedSignature) {
 		return ErrSignatureDoesNotMatch
@@ -180,7 +145,7 @@ func doesPresignV2SignatureMatch(r *http.Request) APIErrorCode {
 
 func getReqAccessKeyV2(r *http.Request) (auth.Credentials, bool, APIErrorCode) {
 	if accessKey := r.URL.Query().Get(xhttp.AmzAccessKeyID); accessKey != "" {
-		return checkKeyValid(accessKey)
+		return checkKeyValid(accessKey, getSessionToken(r))
 	}
 
 	// below is V2 Signed Auth header format, splitting on `space` (after the `AWS` string).
@@ -196,7 +161,7 @@ func getReqAccessKeyV2(r *http.Request) (auth.Credentials, bool, APIErrorCode) {
 		return auth.Credentials{}, false, ErrMissingFields
 	}
 
-	return checkKeyValid(keySignFields[0])
+	return checkKeyValid(keySignFields[0], getSessionToken(r))
 }
 
 // Authorization = "AWS" + " " + AWSAccessKeyId + ":" + Signature;
@@ -258,6 +223,7 @@ func doesSignV2Match(r *http.Request) APIErrorCode {
 	if err != nil {
 		return ErrInvalidQueryParams
 	}
+	encodedResource = getResource(encodedResource, r.Host, GlobalConfig.Http.Domains)
 
 	prefix := fmt.Sprintf("%s %s:", signV2Algorithm, cred.AccessKey)
 	if !strings.HasPrefix(v2Auth, prefix) {
@@ -271,22 +237,16 @@ func doesSignV2Match(r *http.Request) APIErrorCode {
 	return ErrNone
 }
 
-func calculateSignatureV2(stringToSign string, secret string) string {
-	hm := hmac.New(sha1.New, []byte(secret))
-	hm.Write([]byte(stringToSign))
-	return base64.StdEncoding.EncodeToString(hm.Sum(nil))
-}
-
 // Return signature-v2 for the presigned request.
 func preSignatureV2(cred auth.Credentials, method string, encodedResource string, encodedQuery string, headers http.Header, expires string) string {
-	stringToSign := getStringToSignV2(method, encodedResource, encodedQuery, headers, expires)
-	return calculateSignatureV2(stringToSign, cred.SecretKey)
+	stringToSign := signer.StringToSignV2(method, encodedResource, encodedQuery, headers, expires)
+	return signer.SignatureV2(stringToSign, cred.SecretKey)
 }
 
 // Return the signature v2 of a given request.
 func signatureV2(cred auth.Credentials, method string, encodedResource string, encodedQuery string, headers http.Header) string {
-	stringToSign := getStringToSignV2(method, encodedResource, encodedQuery, headers, "")
-	signature := calculateSignatureV2(stringToSign, cred.SecretKey)
+	stringToSign := signer.StringToSignV2(method, encodedResource, encodedQuery, headers, "")
+	signature := signer.SignatureV2(stringToSign, cred.SecretKey)
 	return signature
 }
 
@@ -308,93 +268,30 @@ func compareSignatureV2(sig1, sig2 string) bool {
 	return subtle.ConstantTimeCompare(signature1, signature2) == 1
 }
 
-// Return canonical headers.
-func canonicalizedAmzHeadersV2(headers http.Header) string {
-	var keys []string
-	keyval := make(map[string]string, len(headers))
-	for key := range headers {
-		lkey := strings.ToLower(key)
-		if !strings.HasPrefix(lkey, "x-amz-") {
-			continue
-		}
-		keys = append(keys, lkey)
-		keyval[lkey] = strings.Join(headers[key], ",")
-	}
-	sort.Strings(keys)
-	var canonicalHeaders []string
-	for _, key := range keys {
-		canonicalHeaders = append(canonicalHeaders, key+":"+keyval[key])
+// getResource returns "/bucket/object" for both path-style and virtual-host-style
+// requests, virtual-host-style requests carry the bucket in the Host header only.
+func getResource(path string, host string, domains []string) string {
+	if bucket, ok := virtualHostBucket(host, domains); ok {
+		return SlashSeparator + bucket + path
 	}
-	return strings.Join(canonicalHeaders, "\n")
+	return path
 }
 
-// Return canonical resource string.
-func canonicalizedResourceV2(encodedResource, encodedQuery string) string {
-	queries := strings.Split(encodedQuery, "&")
-	keyval := make(map[string]string)
-	for _, query := range queries {
-		key := query
-		val := ""
-		index := strings.Index(query, "=")
-		if index != -1 {
-			key = query[:index]
-			val = query[index+1:]
-		}
-		keyval[key] = val
+// virtualHostBucket returns the bucket of a virtual-host-style request whose
+// Host is bucket.domain[:port] for one of the configured domains.
+func virtualHostBucket(host string, domains []string) (string, bool) {
+	if len(domains) == 0 {
+		return "", false
 	}
-
-	var canonicalQueries []string
-	for _, key := range resourceList {
-		val, ok := keyval[key]
-		if !ok {
-			continue
-		}
-		if val == "" {
-			canonicalQueries = append(canonicalQueries, key)
-			continue
-		}
-		canonicalQueries = append(canonicalQueries, key+"="+val)
-	}
-
-	// The queries will be already sorted as resourceList is sorted, if canonicalQueries
-	// is empty strings.Join returns empty.
-	canonicalQuery := strings.Join(canonicalQueries, "&")
-	if canonicalQuery != "" {
-		return encodedResource + "?" + canonicalQuery
+	// In bucket.mydomain.com:9000, strip out :9000
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
 	}
-	return encodedResource
-}
-
-// Return string to sign under two different conditions.
-// - if expires string is set then string to sign includes date instead of the Date header.
-// - if expires string is empty then string to sign includes date header instead.
-func getStringToSignV2(method string, encodedResource, encodedQuery string, headers http.Header, expires string) string {
-	canonicalHeaders := canonicalizedAmzHeadersV2(headers)
-	if len(canonicalHeaders) > 0 {
-		canonicalHeaders += "\n"
-	}
-
-	date := expires // Date is set to expires date for presign operations.
-	if date == "" {
-		// If expires date is empty then request header Date is used.
-		date = headers.Get(xhttp.Date)
+	host = strings.ToLower(host)
+	for _, domain := range domains {
+		if strings.HasSuffix(host, "."+domain) {
+			return strings.TrimSuffix(host, "."+domain), true
+		}
 	}
-
-	// From the Amazon docs:
-	//
-	// StringToSign = HTTP-Verb + "\n" +
-	// 	 Content-Md5 + "\n" +
-	//	 Content-Type + "\n" +
-	//	 Date/Expires + "\n" +
-	//	 CanonicalizedProtocolHeaders +
-	//	 CanonicalizedResource;
-	stringToSign := strings.Join([]string{
-		method,
-		headers.Get(xhttp.ContentMD5),
-		headers.Get(xhttp.ContentType),
-		date,
-		canonicalHeaders,
-	}, "\n")
-
-	return stringToSign + canonicalizedResourceV2(encodedResource, encodedQuery)
+	return "", false
 }
@@ -19,15 +19,14 @@ package cmd
 
 import (
 	"bytes"
-	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"s3Gateway/internal/utils"
 	"strconv"
-	"strings"
 
 	"s3Gateway/internal/auth"
 	xhttp "s3Gateway/internal/http"
@@ -111,26 +110,27 @@ func isValidRegion(reqRegion string, confRegion string) bool {
 }
 
 // check if the access key is valid and recognized, additionally
-// also returns if the access key is owner/admin.
-func checkKeyValid(accessKey string) (auth.Credentials, bool, APIErrorCode) {
-	rep, err := UserSecret(accessKey)
+// also returns if the access key is owner/admin. Requests carrying a
+// session token are validated against the temporary credentials.
+func checkKeyValid(accessKey, sessionToken string) (auth.Credentials, bool, APIErrorCode) {
+	if sessionToken != "" {
+		cred, s3Err := checkTempCredentials(accessKey, sessionToken)
+		return cred, false, s3Err
+	}
+	secretKey, err := GlobalCredentialCache.Get(accessKey)
 	cred := auth.Credentials{}
 	if err != nil {
-		return cred, false, ErrNoAccessKey
+		if errors.Is(err, errNoSuchUser) {
+			return cred, false, ErrNoAccessKey
+		}
+		return cred, false, ErrBusy
 	}
-	cred.SecretKey = rep.Data
+	cred.SecretKey = secretKey
 	cred.AccessKey = accessKey
 	//这里使用是ak换取用户信息..
 	return cred, true, ErrNone
 }
 
-// sumHMAC calculate hmac between two input byte array.
-func sumHMAC(key []byte, data []byte) []byte {
-	hash := hmac.New(sha256.New, key)
-	hash.Write(data)
-	return hash.Sum(nil)
-}
-
 // extractSignedHeaders extract signed headers from Authorization header
 func extractSignedHeaders(signedHeaders []string, r *http.Request) (http.Header, APIErrorCode) {
 	reqHeaders := r.Header
@@ -189,11 +189,3 @@ func extractSignedHeaders(signedHeaders []string, r *http.Request) (http.Header,
 	}
 	return extractedSignedHeaders, ErrNone
 }
-
-// Trim leading and trailing spaces and replace sequential spaces with one space, following Trimall()
-// in http://docs.aws.amazon.com/general/latest/gr/sigv4-create-canonical-request.html
-func signV4TrimAll(input string) string {
-	// Compress adjacent spaces (a space is determined by
-	// unicode.IsSpace() internally here) to one space and return
-	return strings.Join(strings.Fields(input), " ")
-}
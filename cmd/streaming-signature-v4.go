@@ -33,6 +33,7 @@ import (
 	humanize "github.com/dustin/go-humanize"
 	"s3Gateway/internal/auth"
 	xhttp "s3Gateway/internal/http"
+	"s3Gateway/pkg/signer"
 )
 
 // Streaming AWS Signature Version '4' constants.
@@ -48,16 +49,16 @@ func getChunkSignature(cred auth.Credentials, seedSignature string, region strin
 	// Calculate string to sign.
 	stringToSign := signV4ChunkedAlgorithm + "\n" +
 		date.Format(iso8601Format) + "\n" +
-		getScope(date, region) + "\n" +
+		signer.Scope(date, region, string(serviceS3)) + "\n" +
 		seedSignature + "\n" +
 		emptySHA256 + "\n" +
 		hashedChunk
 
 	// Get hmac signing key.
-	signingKey := getSigningKey(cred.SecretKey, date, region, serviceS3)
+	signingKey := signer.SigningKey(cred.SecretKey, date, region, string(serviceS3))
 
 	// Calculate signature.
-	newSignature := getSignature(signingKey, stringToSign)
+	newSignature := signer.Signature(signingKey, stringToSign)
 
 	return newSignature
 }
@@ -74,7 +75,7 @@ func calculateSeedSignature(r *http.Request) (cred auth.Credentials, signature s
 	v4Auth := req.Header.Get(xhttp.Authorization)
 
 	// Parse signature version '4' header.
-	signV4Values, errCode := parseSignV4(v4Auth, globalServerRegion, serviceS3)
+	signV4Values, errCode := parseSignV4(v4Auth, serverRegion(), serviceS3)
 	if errCode != ErrNone {
 		return cred, "", "", time.Time{}, errCode
 	}
@@ -93,7 +94,7 @@ func calculateSeedSignature(r *http.Request) (cred auth.Credentials, signature s
 		return cred, "", "", time.Time{}, errCode
 	}
 
-	cred, _, errCode = checkKeyValid(signV4Values.Credential.accessKey)
+	cred, _, errCode = checkKeyValid(signV4Values.Credential.accessKey, getSessionToken(r))
 	if errCode != ErrNone {
 		return cred, "", "", time.Time{}, errCode
 	}
@@ -120,16 +121,16 @@ func calculateSeedSignature(r *http.Request) (cred auth.Credentials, signature s
 	queryStr := req.URL.Query().Encode()
 
 	// Get canonical request.
-	canonicalRequest := getCanonicalRequest(extractedSignedHeaders, payload, queryStr, req.URL.Path, req.Method)
+	canonicalRequest := signer.CanonicalRequest(extractedSignedHeaders, payload, queryStr, req.URL.Path, req.Method)
 
 	// Get string to sign from canonical request.
-	stringToSign := getStringToSign(canonicalRequest, date, signV4Values.Credential.getScope())
+	stringToSign := signer.StringToSign(canonicalRequest, date, signV4Values.Credential.getScope())
 
 	// Get hmac signing key.
-	signingKey := getSigningKey(cred.SecretKey, signV4Values.Credential.scope.date, region, serviceS3)
+	signingKey := signer.SigningKey(cred.SecretKey, signV4Values.Credential.scope.date, region, string(serviceS3))
 
 	// Calculate signature.
-	newSignature := getSignature(signingKey, stringToSign)
+	newSignature := signer.Signature(signingKey, stringToSign)
 
 	// Verify if signature match.
 	if !compareSignatureV4(newSignature, signV4Values.Signature) {
@@ -154,10 +155,12 @@ var errMalformedEncoding = errors.New("malformed chunked encoding")
 //
 // NewChunkedReader is not needed by normal applications. The http package
 // automatically decodes chunking when reading response bodies.
-func newSignV4ChunkedReader(req *http.Request) (io.ReadCloser, APIErrorCode) {
+//
+// The credentials of the seed signature are returned alongside the reader.
+func newSignV4ChunkedReader(req *http.Request) (io.ReadCloser, auth.Credentials, APIErrorCode) {
 	cred, seedSignature, region, seedDate, errCode := calculateSeedSignature(req)
 	if errCode != ErrNone {
-		return nil, errCode
+		return nil, cred, errCode
 	}
 
 	return &s3ChunkedReader{
@@ -168,7 +171,7 @@ func newSignV4ChunkedReader(req *http.Request) (io.ReadCloser, APIErrorCode) {
 		region:            region,
 		chunkSHA256Writer: sha256.New(),
 		buffer:            make([]byte, 64*1024),
-	}, ErrNone
+	}, cred, ErrNone
 }
 
 // Represents the overall state that is required for decoding a
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	iampolicy "github.com/minio/pkg/iam/policy"
+	"s3Gateway/internal/logger"
+	mxml "s3Gateway/model/xml"
+)
+
+//STS 接口: POST / 表单参数 Action=AssumeRole|GetSessionToken&Version=2011-06-15
+//请求需要使用长期凭证按 sts 服务签名, 返回的临时凭证以调用者的身份访问, 可由 session policy 进一步限制
+
+const (
+	stsAPIVersion      = "2011-06-15"
+	stsAction          = "Action"
+	stsVersion         = "Version"
+	stsPolicy          = "Policy"
+	stsDurationSeconds = "DurationSeconds"
+	stsRoleSessionName = "RoleSessionName"
+
+	stsAssumeRole      = "AssumeRole"
+	stsGetSessionToken = "GetSessionToken"
+
+	stsMinDuration = 15 * time.Minute
+	// AssumeRole 默认 1 小时, 最长 12 小时
+	stsAssumeRoleDefaultDuration = time.Hour
+	stsAssumeRoleMaxDuration     = 12 * time.Hour
+	// GetSessionToken 默认 12 小时, 最长 36 小时
+	stsSessionTokenDefaultDuration = 12 * time.Hour
+	stsSessionTokenMaxDuration     = 36 * time.Hour
+	// maxSessionPolicySize session policy 大小上限, 与 AWS 一致
+	maxSessionPolicySize = 2048
+)
+
+type STS struct{}
+
+//Handle POST /, 按 Action 分发
+func (s *STS) Handle(w http.ResponseWriter, r *http.Request) {
+	ctx := newContext(r, w, apiSTS)
+	if getRequestAuthType(r) != authTypeSigned {
+		writeSTSErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrAccessDenied))
+		return
+	}
+	region := serverRegion()
+	if s3Err := isReqAuthenticated(ctx, r, region, serviceSTS); s3Err != ErrNone {
+		writeSTSErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Err))
+		return
+	}
+	cred, _, s3Err := getReqAccessKeyV4(r, region, serviceSTS)
+	if s3Err != ErrNone {
+		writeSTSErrorResponse(ctx, w, errorCodes.ToAPIErr(s3Err))
+		return
+	}
+	//临时凭证不能再换取临时凭证
+	if cred.IsTemp() || !isIAMUserEnabled(cred.AccessKey) {
+		writeSTSErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrAccessDenied))
+		return
+	}
+	if err := SetKey(ctx, cred); err != ErrNone {
+		writeSTSErrorResponse(ctx, w, errorCodes.ToAPIErr(err))
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeSTSErrorResponse(ctx, w, errorCodes.ToAPIErrWithErr(ErrInvalidRequest, err))
+		return
+	}
+	if r.Form.Get(stsVersion) != stsAPIVersion {
+		writeSTSErrorResponse(ctx, w, errorCodes.ToAPIErrWithErr(ErrInvalidRequest, fmt.Errorf("invalid STS API version %q, expecting %q", r.Form.Get(stsVersion), stsAPIVersion)))
+		return
+	}
+
+	var response interface{}
+	switch action := r.Form.Get(stsAction); action {
+	case stsAssumeRole:
+		ctx = newContext(r, w, apiAssumeRole)
+		duration, apiErr := parseSTSDuration(r.Form.Get(stsDurationSeconds), stsAssumeRoleDefaultDuration, stsAssumeRoleMaxDuration)
+		if apiErr != nil {
+			writeSTSErrorResponse(ctx, w, apiErr)
+			return
+		}
+		sessionPolicy, apiErr := parseSessionPolicy(r.Form.Get(stsPolicy))
+		if apiErr != nil {
+			writeSTSErrorResponse(ctx, w, apiErr)
+			return
+		}
+		tempCred, err := newTempCredentials(cred.AccessKey, cred.SecretKey, duration, sessionPolicy)
+		if err != nil {
+			logger.Error("issue temporary credentials for %s error:%s", cred.AccessKey, err.Error())
+			writeSTSErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrInternalError))
+			return
+		}
+		result := mxml.AssumeRoleResult{Credentials: tempCred}
+		result.AssumedRoleUser.AssumedRoleID = tempCred.AccessKey + ":" + r.Form.Get(stsRoleSessionName)
+		result.AssumedRoleUser.Arn = "arn:aws:sts:::assumed-role/" + cred.AccessKey + "/" + r.Form.Get(stsRoleSessionName)
+		response = mxml.AssumeRoleResponse{Result: result}
+	case stsGetSessionToken:
+		ctx = newContext(r, w, apiGetSessionToken)
+		duration, apiErr := parseSTSDuration(r.Form.Get(stsDurationSeconds), stsSessionTokenDefaultDuration, stsSessionTokenMaxDuration)
+		if apiErr != nil {
+			writeSTSErrorResponse(ctx, w, apiErr)
+			return
+		}
+		tempCred, err := newTempCredentials(cred.AccessKey, cred.SecretKey, duration, nil)
+		if err != nil {
+			logger.Error("issue temporary credentials for %s error:%s", cred.AccessKey, err.Error())
+			writeSTSErrorResponse(ctx, w, errorCodes.ToAPIErr(ErrInternalError))
+			return
+		}
+		response = mxml.GetSessionTokenResponse{Result: mxml.GetSessionTokenResult{Credentials: tempCred}}
+	default:
+		writeSTSErrorResponse(ctx, w, errorCodes.ToAPIErrWithErr(ErrNotImplemented, fmt.Errorf("unsupported STS action %q", action)))
+		return
+	}
+	WriteSuccessResponseXML(w, EncodeResponse(response))
+}
+
+//parseSTSDuration DurationSeconds 为空时使用默认值
+func parseSTSDuration(value string, def, max time.Duration) (time.Duration, *APIError) {
+	if value == "" {
+		return def, nil
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	duration := time.Duration(seconds) * time.Second
+	if err != nil || duration < stsMinDuration || duration > max {
+		return 0, errorCodes.ToAPIErrWithErr(ErrInvalidDuration, fmt.Errorf("DurationSeconds must be between %d and %d", int64(stsMinDuration/time.Second), int64(max/time.Second)))
+	}
+	return duration, nil
+}
+
+//parseSessionPolicy 校验 session policy, 为空时返回 nil
+func parseSessionPolicy(value string) ([]byte, *APIError) {
+	if value == "" {
+		return nil, nil
+	}
+	if len(value) > maxSessionPolicySize {
+		return nil, errorCodes.ToAPIErr(ErrPolicyTooLarge)
+	}
+	p, err := iampolicy.ParseConfig(bytes.NewReader([]byte(value)))
+	if err != nil {
+		return nil, errorCodes.ToAPIErrWithErr(ErrMalformedPolicy, err)
+	}
+	if p.Version == "" || p.IsEmpty() {
+		return nil, errorCodes.ToAPIErr(ErrMalformedPolicy)
+	}
+	return []byte(value), nil
+}
+
+//writeSTSErrorResponse STS 格式的错误响应
+func writeSTSErrorResponse(ctx context.Context, w http.ResponseWriter, err *APIError) {
+	errType := "Sender"
+	if err.HTTPStatusCode >= http.StatusInternalServerError {
+		errType = "Receiver"
+	}
+	requestID := ""
+	if reqInfo, ok := GetReqInfo(ctx); ok {
+		requestID = reqInfo.RequestID
+		reqInfo.ErrorCode = err.Code
+	}
+	response := mxml.STSErrorResponse{
+		Error:     mxml.STSError{Type: errType, Code: err.Code, Message: err.Description},
+		RequestID: requestID,
+	}
+	WriteResponse(w, err.HTTPStatusCode, EncodeResponse(response), mimeXML)
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/minio/pkg/bucket/policy"
+	iampolicy "github.com/minio/pkg/iam/policy"
+	"s3Gateway/internal/auth"
+	xhttp "s3Gateway/internal/http"
+	"s3Gateway/pkg/signer"
+)
+
+//STS 临时凭证, 网关不保存状态:
+//  session token = base64(claims) + "." + HMAC(父用户 sk, claims)
+//  临时 sk 由父用户 sk 与 claims 计算得到
+//父用户 sk 变更后, 已签发的临时凭证随之失效
+
+const (
+	// stsTempSecretKeyLen 临时 sk 长度
+	stsTempSecretKeyLen = 40
+)
+
+// stsClaims session token 中携带的信息
+type stsClaims struct {
+	AccessKey string `json:"accessKey"`
+	Parent    string `json:"parent"`
+	Expiry    int64  `json:"exp"`
+	// Policy base64 编码的 session policy, 为空时不额外限制
+	Policy string `json:"sessionPolicy,omitempty"`
+}
+
+//newTempCredentials 为父用户签发临时凭证
+func newTempCredentials(parent, parentSecret string, duration time.Duration, sessionPolicy []byte) (auth.Credentials, error) {
+	accessKey, err := auth.GenerateAccessKey()
+	if err != nil {
+		return auth.Credentials{}, err
+	}
+	claims := stsClaims{
+		AccessKey: accessKey,
+		Parent:    parent,
+		Expiry:    time.Now().UTC().Add(duration).Unix(),
+	}
+	if len(sessionPolicy) > 0 {
+		claims.Policy = base64.StdEncoding.EncodeToString(sessionPolicy)
+	}
+	buf, err := json.Marshal(claims)
+	if err != nil {
+		return auth.Credentials{}, err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(buf)
+	token := payload + "." + base64.RawURLEncoding.EncodeToString(stsSign(parentSecret, "token", payload))
+	return tempCredentials(claims, parentSecret, payload, token), nil
+}
+
+//tempCredentials 由 claims 还原临时凭证
+func tempCredentials(claims stsClaims, parentSecret, payload, token string) auth.Credentials {
+	secretKey := base64.StdEncoding.EncodeToString(stsSign(parentSecret, "secret", payload))
+	secretKey = strings.Replace(secretKey, "/", "+", -1)[:stsTempSecretKeyLen]
+	cred := auth.Credentials{
+		AccessKey:    claims.AccessKey,
+		SecretKey:    secretKey,
+		Expiration:   time.Unix(claims.Expiry, 0).UTC(),
+		SessionToken: token,
+		Status:       auth.AccountOn,
+		ParentUser:   claims.Parent,
+	}
+	if claims.Policy != "" {
+		cred.Claims = map[string]interface{}{iampolicy.SessionPolicyName: claims.Policy}
+	}
+	return cred
+}
+
+func stsSign(parentSecret, purpose, payload string) []byte {
+	return signer.SumHMAC([]byte(parentSecret), []byte("s3gateway-sts-"+purpose+":"+payload))
+}
+
+//checkTempCredentials 校验 session token 并返回 accessKey 对应的临时凭证
+func checkTempCredentials(accessKey, token string) (auth.Credentials, APIErrorCode) {
+	i := strings.Index(token, ".")
+	if i < 0 {
+		return auth.Credentials{}, ErrInvalidToken
+	}
+	payload := token[:i]
+	sig, err := base64.RawURLEncoding.DecodeString(token[i+1:])
+	if err != nil {
+		return auth.Credentials{}, ErrInvalidToken
+	}
+	buf, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return auth.Credentials{}, ErrInvalidToken
+	}
+	claims := stsClaims{}
+	if err := json.Unmarshal(buf, &claims); err != nil || claims.Parent == "" {
+		return auth.Credentials{}, ErrInvalidToken
+	}
+	if claims.AccessKey != accessKey {
+		return auth.Credentials{}, ErrInvalidToken
+	}
+	parentSecret, err := GlobalCredentialCache.Get(claims.Parent)
+	if err != nil {
+		if errors.Is(err, errNoSuchUser) {
+			return auth.Credentials{}, ErrInvalidToken
+		}
+		return auth.Credentials{}, ErrBusy
+	}
+	if !hmac.Equal(sig, stsSign(parentSecret, "token", payload)) {
+		return auth.Credentials{}, ErrInvalidToken
+	}
+	cred := tempCredentials(claims, parentSecret, payload, token)
+	if cred.IsExpired() {
+		return cred, ErrExpiredToken
+	}
+	return cred, ErrNone
+}
+
+//getSessionToken 请求头或预签名查询参数中的 x-amz-security-token
+func getSessionToken(r *http.Request) string {
+	if token := r.Header.Get(xhttp.AmzSecurityToken); token != "" {
+		return token
+	}
+	return r.URL.Query().Get(xhttp.AmzSecurityToken)
+}
+
+//checkSessionPolicy 临时凭证携带 session policy 时, 请求还需要由 session policy 允许
+func checkSessionPolicy(r *http.Request, action policy.Action, bucketName, objectName string, cred auth.Credentials) APIErrorCode {
+	encoded, _ := cred.Claims[iampolicy.SessionPolicyName].(string)
+	if encoded == "" {
+		return ErrNone
+	}
+	buf, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrAccessDenied
+	}
+	p, err := iampolicy.ParseConfig(bytes.NewReader(buf))
+	if err != nil {
+		return ErrAccessDenied
+	}
+	if !p.IsAllowed(iampolicy.Args{
+		AccountName:     cred.ParentUser,
+		Action:          iampolicy.Action(action),
+		BucketName:      bucketName,
+		ObjectName:      objectName,
+		ConditionValues: getConditionValues(r, cred),
+	}) {
+		return ErrAccessDenied
+	}
+	return ErrNone
+}
+
+//parentCredentials 临时凭证以父用户的身份访问存储后端
+func parentCredentials(cred auth.Credentials) (auth.Credentials, APIErrorCode) {
+	secretKey, err := GlobalCredentialCache.Get(cred.ParentUser)
+	if err != nil {
+		if errors.Is(err, errNoSuchUser) {
+			return cred, ErrInvalidToken
+		}
+		return cred, ErrBusy
+	}
+	return auth.Credentials{AccessKey: cred.ParentUser, SecretKey: secretKey}, ErrNone
+}
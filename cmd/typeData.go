@@ -7,10 +7,19 @@ import (
 
 const (
 	SlashSeparator      = "/"
-	globalServerRegion  = "us-east-1"
 	globalMaxSkewTime   = 15 * time.Minute // 15 minutes skew allowed.
 	stsRequestBodyLimit = 10 * (1 << 20)   // 10 MiB
 	requestInfo         = "requestInfo"
+	s3Namespace         = "http://s3.amazonaws.com/doc/2006-03-01/"
+	maxObjectList       = 1000 // Limit number of objects in a listObjectsResponse.
 )
 
 var GlobalConfig *yml.Config
+
+//serverRegion 网关所在区域, 签名校验及桶的 LocationConstraint 使用
+func serverRegion() string {
+	if GlobalConfig == nil || GlobalConfig.Region == "" {
+		return yml.DefaultRegion
+	}
+	return GlobalConfig.Region
+}
@@ -74,6 +74,9 @@ var errGroupNotEmpty = errors.New("Specified group is not empty - cannot remove
 // error returned in IAM subsystem when policy doesn't exist.
 var errNoSuchPolicy = errors.New("Specified canned policy does not exist")
 
+// error returned in IAM subsystem when a policy to be deleted is still attached.
+var errPolicyInUse = errors.New("Specified policy is attached to a user or group")
+
 // error returned in IAM subsystem when an external users systems is configured.
 var errIAMActionNotAllowed = errors.New("Specified IAM action is not allowed with LDAP configuration")
 
@@ -88,3 +91,18 @@ var errLockedObject = errors.New("Object is WORM protected and cannot be overwri
 
 // error returned when upload id not found
 var errUploadIDNotFound = errors.New("Specified Upload ID is not found")
+
+// error returned when a part of a multipart upload is missing or its etag does not match
+var errInvalidPart = errors.New("One or more of the specified parts could not be found")
+
+// error returned when the parts of a multipart upload are not in ascending order
+var errInvalidPartOrder = errors.New("The list of parts was not in ascending order")
+
+// error returned when a part other than the last one is smaller than 5MiB
+var errPartTooSmall = errors.New("Your proposed upload is smaller than the minimum allowed object size")
+
+// error returned when a bucket policy is set on a bucket that was not created through the gateway
+var errNoBucketOwner = errors.New("The bucket has no recorded owner")
+
+// error returned when a post form sends the file as a plain field larger than maxFormMemory
+var errPostFileFieldTooLarge = errors.New("Your proposed upload exceeds the maximum allowed size of a form field")
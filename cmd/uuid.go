@@ -1,8 +1,8 @@
 package cmd
 
 import (
+	"crypto/rand"
 	"fmt"
-	"math/rand"
 )
 
 // GenerateRandomBytes is used to generate random bytes of given size.
@@ -117,6 +117,8 @@ const (
 
 	// Response request id.
 	AmzRequestID = "x-amz-request-id"
+	// Response host id, identifies the gateway node serving the request.
+	AmzRequestHostID = "x-amz-id-2"
 
 	// Deployment id.
 	MinioDeploymentID = "x-minio-deployment-id"
@@ -1,12 +1,21 @@
 package logger
 
 import (
-	"log"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-var loggerLevel = InfoLevel
-var logger = log.New(os.Stderr, "", log.LstdFlags)
+//结构化日志, 每条日志包含 time/level/pkg/msg 及附加字段, 输出格式为 logfmt 或 json
+//pkg 为调用方所在的包名(cmd、main 等), 可以按包单独设置日志级别
 
 const (
 	_ = iota
@@ -17,37 +26,283 @@ const (
 	ExitLevel
 )
 
-func Info(format string, args ...interface{}) {
-	if loggerLevel > InfoLevel {
-		return
+const (
+	FormatLogfmt = "logfmt"
+	FormatJSON   = "json"
+)
+
+// Fields 日志附加字段
+type Fields map[string]interface{}
+
+var (
+	mu            sync.Mutex
+	output        io.Writer = os.Stderr
+	format                  = FormatLogfmt
+	loggerLevel             = InfoLevel
+	packageLevels           = map[string]int{}
+)
+
+// severity 级别常量的数值与配置保持兼容, 比较时按 debug < info < warn < error < exit
+var severity = map[int]int{
+	DebugLevel: 0,
+	InfoLevel:  1,
+	WarnLevel:  2,
+	ErrorLevel: 3,
+	ExitLevel:  4,
+}
+
+var levelNames = map[int]string{
+	DebugLevel: "debug",
+	InfoLevel:  "info",
+	WarnLevel:  "warn",
+	ErrorLevel: "error",
+	ExitLevel:  "exit",
+}
+
+// Logger 携带包名及附加字段的日志记录器
+type Logger struct {
+	pkg    string
+	fields Fields
+}
+
+//Named 使用指定名称代替调用方包名, 例如访问日志使用 access
+func Named(pkg string) *Logger {
+	return &Logger{pkg: pkg}
+}
+
+//WithFields 返回携带附加字段的记录器
+func WithFields(fields Fields) *Logger {
+	return &Logger{pkg: callerPackage(2), fields: fields}
+}
+
+//WithFields 追加附加字段, 同名字段覆盖
+func (l *Logger) WithFields(fields Fields) *Logger {
+	merged := make(Fields, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
 	}
-	logger.Printf("[info]"+format, args...)
+	return &Logger{pkg: l.pkg, fields: merged}
+}
+
+func (l *Logger) Info(format string, args ...interface{}) {
+	l.log(InfoLevel, format, args...)
+}
+func (l *Logger) Debug(format string, args ...interface{}) {
+	l.log(DebugLevel, format, args...)
+}
+func (l *Logger) Warn(format string, args ...interface{}) {
+	l.log(WarnLevel, format, args...)
+}
+func (l *Logger) Error(format string, args ...interface{}) {
+	l.log(ErrorLevel, format, args...)
+}
+
+func Info(format string, args ...interface{}) {
+	(&Logger{pkg: callerPackage(2)}).log(InfoLevel, format, args...)
 }
 func Debug(format string, args ...interface{}) {
-	if loggerLevel > DebugLevel {
-		return
-	}
-	logger.Printf("[debug]"+format, args...)
+	(&Logger{pkg: callerPackage(2)}).log(DebugLevel, format, args...)
 }
 func Warn(format string, args ...interface{}) {
-	if loggerLevel > WarnLevel {
-		return
-	}
-	logger.Printf("[warn]"+format, args...)
+	(&Logger{pkg: callerPackage(2)}).log(WarnLevel, format, args...)
 }
 func Error(format string, args ...interface{}) {
-	if loggerLevel > ErrorLevel {
-		return
-	}
-	logger.Printf("[error]"+format, args...)
+	(&Logger{pkg: callerPackage(2)}).log(ErrorLevel, format, args...)
 }
 func Exit(format string, args ...interface{}) {
-	if loggerLevel > ExitLevel {
-		return
-	}
-	logger.Printf("[exit]"+format, args...)
+	(&Logger{pkg: callerPackage(2)}).log(ExitLevel, format, args...)
 	os.Exit(1)
 }
 func SetLogLevel(n int) {
+	mu.Lock()
+	defer mu.Unlock()
 	loggerLevel = n
 }
+
+//SetPackageLevel 设置指定包的日志级别, 未设置的包使用 SetLogLevel 的级别
+func SetPackageLevel(pkg string, n int) {
+	mu.Lock()
+	defer mu.Unlock()
+	packageLevels[pkg] = n
+}
+
+//SetFormat 设置输出格式 logfmt | json
+func SetFormat(f string) error {
+	f, err := ParseFormat(f)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	format = f
+	return nil
+}
+
+//SetOutput 设置日志输出, 默认 stderr
+func SetOutput(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	output = w
+}
+
+//ParseLevel 解析日志级别, 支持数字 1-5 及 info/debug/warn/error/exit
+func ParseLevel(level string) (int, error) {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "", "1", "info":
+		return InfoLevel, nil
+	case "2", "debug":
+		return DebugLevel, nil
+	case "3", "warn":
+		return WarnLevel, nil
+	case "4", "error":
+		return ErrorLevel, nil
+	case "5", "exit":
+		return ExitLevel, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", level)
+}
+
+//ParseFormat 解析输出格式, 为空时使用 logfmt
+func ParseFormat(f string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(f)) {
+	case "", FormatLogfmt:
+		return FormatLogfmt, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	}
+	return "", fmt.Errorf("unknown log format %q", f)
+}
+
+func (l *Logger) log(level int, msgFormat string, args ...interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+	threshold, ok := packageLevels[l.pkg]
+	if !ok {
+		threshold = loggerLevel
+	}
+	if level != ExitLevel && severity[level] < severity[threshold] {
+		return
+	}
+	msg := msgFormat
+	if len(args) > 0 {
+		msg = fmt.Sprintf(msgFormat, args...)
+	}
+	var buf bytes.Buffer
+	if format == FormatJSON {
+		encodeJSON(&buf, time.Now(), levelNames[level], l.pkg, msg, l.fields)
+	} else {
+		encodeLogfmt(&buf, time.Now(), levelNames[level], l.pkg, msg, l.fields)
+	}
+	output.Write(buf.Bytes())
+}
+
+// fixedKeys 每条日志固定的字段, 附加字段按名称排序输出在其后
+var fixedKeys = []string{"time", "level", "pkg", "msg"}
+
+func sortedKeys(fields Fields) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		switch k {
+		case "time", "level", "pkg", "msg":
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func encodeJSON(buf *bytes.Buffer, t time.Time, level, pkg, msg string, fields Fields) {
+	fixed := []string{t.Format(time.RFC3339Nano), level, pkg, msg}
+	buf.WriteByte('{')
+	for i, k := range fixedKeys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeJSONValue(buf, k)
+		buf.WriteByte(':')
+		writeJSONValue(buf, fixed[i])
+	}
+	for _, k := range sortedKeys(fields) {
+		buf.WriteByte(',')
+		writeJSONValue(buf, k)
+		buf.WriteByte(':')
+		writeJSONValue(buf, fieldValue(fields[k]))
+	}
+	buf.WriteString("}\n")
+}
+
+func writeJSONValue(buf *bytes.Buffer, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(b)
+}
+
+func encodeLogfmt(buf *bytes.Buffer, t time.Time, level, pkg, msg string, fields Fields) {
+	fixed := []string{t.Format(time.RFC3339Nano), level, pkg, msg}
+	for i, k := range fixedKeys {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		writeLogfmtPair(buf, k, fixed[i])
+	}
+	for _, k := range sortedKeys(fields) {
+		buf.WriteByte(' ')
+		writeLogfmtPair(buf, k, fieldValue(fields[k]))
+	}
+	buf.WriteByte('\n')
+}
+
+func writeLogfmtPair(buf *bytes.Buffer, key string, v interface{}) {
+	buf.WriteString(key)
+	buf.WriteByte('=')
+	s := fmt.Sprint(v)
+	if s == "" || strings.ContainsAny(s, " =\"\\\t\r\n") {
+		s = strconv.Quote(s)
+	}
+	buf.WriteString(s)
+}
+
+// fieldValue error 及 Duration 转换为便于检索的值, Duration 以毫秒记录
+func fieldValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case error:
+		return x.Error()
+	case time.Duration:
+		return float64(x) / float64(time.Millisecond)
+	case fmt.Stringer:
+		return x.String()
+	}
+	return v
+}
+
+// callerPackages pc -> 包名缓存
+var callerPackages sync.Map
+
+//callerPackage 调用方的包名, 取函数全名最后一个 / 之后第一个 . 之前的部分
+func callerPackage(skip int) string {
+	pc, _, _, ok := runtime.Caller(skip)
+	if !ok {
+		return ""
+	}
+	if v, ok := callerPackages.Load(pc); ok {
+		return v.(string)
+	}
+	name := ""
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		name = fn.Name()
+		if i := strings.LastIndex(name, "/"); i >= 0 {
+			name = name[i+1:]
+		}
+		if i := strings.Index(name, "."); i >= 0 {
+			name = name[:i]
+		}
+	}
+	callerPackages.Store(pc, name)
+	return name
+}
@@ -0,0 +1,112 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+//按大小切割的日志文件, 超过 maxSize 时重命名为 file.yyyymmdd-hhmmss.000 并新建文件, 保留最近 maxBackups 个
+
+const rotateTimeFormat = "20060102-150405.000"
+
+// RotateFile 实现 io.WriteCloser
+type RotateFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+//NewRotateFile maxSize 为 0 时不切割, maxBackups 为 0 时保留所有切割出的文件
+func NewRotateFile(path string, maxSize int64, maxBackups int) (*RotateFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f := &RotateFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotateFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (f *RotateFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			//切割失败时继续写入原文件
+			os.Stderr.WriteString("rotate log file error:" + err.Error() + "\n")
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+//Reopen 重新打开日志文件, 文件被外部工具移走后使用
+func (f *RotateFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.file.Close()
+	return f.open()
+}
+
+func (f *RotateFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+func (f *RotateFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	backup := f.path + "." + time.Now().Format(rotateTimeFormat)
+	if err := os.Rename(f.path, backup); err != nil {
+		//重命名失败时重新打开原文件, 保证后续日志可以写入
+		if openErr := f.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.removeBackups()
+	return nil
+}
+
+//removeBackups 删除超出 maxBackups 的旧文件, 文件名中的时间按字典序即为时间顺序
+func (f *RotateFile) removeBackups() {
+	if f.maxBackups <= 0 {
+		return
+	}
+	backups, err := filepath.Glob(f.path + ".*")
+	if err != nil || len(backups) <= f.maxBackups {
+		return
+	}
+	sort.Strings(backups)
+	for _, name := range backups[:len(backups)-f.maxBackups] {
+		os.Remove(name)
+	}
+}
@@ -2,49 +2,188 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"github.com/gorilla/mux"
-	"gopkg.in/yaml.v3"
-	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"s3Gateway/cmd"
 	"s3Gateway/internal/logger"
 	"s3Gateway/model/yml"
+	"strings"
+	"syscall"
 )
 
-func init() {
-	cmd.GlobalConfig = &yml.Config{}
+//setFlags 命令行 -set key=value, 可重复
+type setFlags []string
+
+func (s *setFlags) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *setFlags) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("%q must be key=value", value)
+	}
+	*s = append(*s, value)
+	return nil
 }
 
 func main() {
+	var sets setFlags
 	configPath := flag.String("c", "./config.yaml", "load config(yaml)")
+	flag.Var(&sets, "set", "override config field by yaml path, e.g. -set http.addr=:9000 (repeatable)")
 	flag.Parse()
-	//读取配置
-	fp, err := os.Open(*configPath)
+	//读取配置, 优先级: 配置文件 < 环境变量 < -set
+	config, err := yml.Load(*configPath)
 	if err != nil {
-		logger.Error("config load error:%s", err.Error())
+		logger.Exit("config load error:%s", err.Error())
+	}
+	if err := config.ApplyEnv(); err != nil {
+		logger.Exit("config env error:%s", err.Error())
+	}
+	for _, kv := range sets {
+		i := strings.Index(kv, "=")
+		if err := config.Set(kv[:i], kv[i+1:]); err != nil {
+			logger.Exit("config flag error:%s", err.Error())
+		}
+	}
+	if err := config.Validate(); err != nil {
+		logger.Exit("%s", err.Error())
+	}
+	level, _ := logger.ParseLevel(config.Http.InfoLevel)
+	logger.SetLogLevel(level)
+	for pkg, l := range config.Log.Levels {
+		level, _ := logger.ParseLevel(l)
+		logger.SetPackageLevel(pkg, level)
 	}
-	y := yaml.NewDecoder(fp)
-	if err := y.Decode(&cmd.GlobalConfig); err != nil {
-		logger.Error("load yaml error:%s", err.Error())
+	logger.SetFormat(config.Log.Format)
+	var logFile *logger.RotateFile
+	if config.Log.File != "" {
+		logFile, err = logger.NewRotateFile(config.Log.File, config.Log.MaxSize<<20, config.Log.MaxBackups)
+		if err != nil {
+			logger.Exit("open log file error:%s", err.Error())
+		}
+		logger.SetOutput(logFile)
 	}
+	cmd.GlobalConfig = config
 
-	router := mux.NewRouter()
-	router = router.PathPrefix("/").Subrouter()
-	router.Use(cmd.SetAuthHandler, cmd.AccessLog)
-	domains := []string{}
+	rootRouter := mux.NewRouter()
+	//监控指标、健康检查及版本, 不经过鉴权及访问日志
+	gatewayRouter := rootRouter.MatcherFunc(cmd.IsGatewayEndpoint).Subrouter()
+	gatewayRouter.Methods(http.MethodGet).Path(cmd.MetricsPath).Handler(cmd.MetricsHandler())
+	gatewayRouter.Methods(http.MethodGet, http.MethodHead).Path(cmd.HealthLivePath).HandlerFunc(cmd.LiveHandler)
+	gatewayRouter.Methods(http.MethodGet, http.MethodHead).Path(cmd.HealthReadyPath).HandlerFunc(cmd.ReadyHandler)
+	gatewayRouter.Methods(http.MethodGet).Path(cmd.VersionPath).HandlerFunc(cmd.VersionHandler)
+	router := rootRouter.PathPrefix("/").Subrouter()
+	router.Use(cmd.SetRequestIDHandler, cmd.AccessLog, cmd.SetAuthHandler)
+	//管理接口, 需在桶路由之前注册
+	adminRouter := router.PathPrefix(cmd.AdminPathPrefix).Subrouter()
+	//预签名 URL 生成, 同样需在桶路由之前注册
+	presignRouter := router.Path(cmd.PresignPath).Subrouter()
+	//虚拟主机风格 bucket.domain/object
+	domains := cmd.GlobalConfig.Http.Domains
 	var routers []*mux.Router
 	for _, domainName := range domains {
 		routers = append(routers, router.Host("{bucket:.+}."+domainName).Subrouter())
 	}
 	routers = append(routers, router.PathPrefix("/{bucket}").Subrouter())
 
-	bucket := cmd.Bucket{}
-	object := cmd.Object{}
+	var backend cmd.Backend
+	switch cmd.GlobalConfig.Backend.Type {
+	case "fs":
+		backend, err = cmd.NewFsBackend(cmd.GlobalConfig.Backend.Fs.Root, cmd.GlobalConfig.Backend.Fs.Users)
+		if err != nil {
+			logger.Exit("fs backend init error:%s", err.Error())
+		}
+	default:
+		if err := cmd.LoadGatewayIdentity(); err != nil {
+			logger.Exit("load gateway identity error:%s", err.Error())
+		}
+		go cmd.WatchGatewayIdentity()
+		backend, err = cmd.NewOpenApiBackend(filepath.Join(cmd.GlobalConfig.Store.Dir, "object-meta"))
+		if err != nil {
+			logger.Exit("open api backend init error:%s", err.Error())
+		}
+	}
+	cmd.GlobalBackend = backend
+	cmd.GlobalCredentialCache = cmd.NewCredentialCache(backend.UserSecret, cmd.GlobalConfig.Credentials.TTL, cmd.GlobalConfig.Credentials.NegativeTTL)
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		for range hup {
+			logger.Info("SIGHUP received, purge credential cache")
+			if logFile != nil {
+				if err := logFile.Reopen(); err != nil {
+					logger.Error("reopen log file error:%s", err.Error())
+				}
+			}
+			cmd.GlobalCredentialCache.Purge()
+			if cmd.GlobalConfig.Backend.Type != "fs" {
+				if err := cmd.LoadGatewayIdentity(); err != nil {
+					logger.Error("reload gateway identity error:%s", err.Error())
+				}
+			}
+		}
+	}()
+	multipart, err := cmd.NewMultipartStore(cmd.GlobalConfig.Multipart.Dir, cmd.GlobalConfig.Multipart.Expiry)
+	if err != nil {
+		logger.Exit("multipart store init error:%s", err.Error())
+	}
+	go multipart.CleanupLoop()
+	policyStore, err := cmd.NewBucketPolicyStore(filepath.Join(cmd.GlobalConfig.Store.Dir, "bucket-policy"))
+	if err != nil {
+		logger.Exit("bucket policy store init error:%s", err.Error())
+	}
+	cmd.GlobalBucketPolicyStore = policyStore
+	iamStore, err := cmd.NewIAMStore(filepath.Join(cmd.GlobalConfig.Store.Dir, "iam"))
+	if err != nil {
+		logger.Exit("iam store init error:%s", err.Error())
+	}
+	cmd.GlobalIAMStore = iamStore
+	admin := cmd.Admin{IAM: iamStore}
+	sts := cmd.STS{}
+	presign := cmd.Presign{}
+	bucket := cmd.Bucket{Backend: backend, Policy: policyStore}
+	object := cmd.Object{Backend: backend, Multipart: multipart}
 
+	{
+		//IAM 策略
+		adminRouter.Methods(http.MethodGet).Path("/policies").HandlerFunc(admin.ListPolicies)
+		adminRouter.Methods(http.MethodGet).Path("/policies/{name}").HandlerFunc(admin.GetPolicy)
+		adminRouter.Methods(http.MethodPut).Path("/policies/{name}").HandlerFunc(admin.PutPolicy)
+		adminRouter.Methods(http.MethodDelete).Path("/policies/{name}").HandlerFunc(admin.DeletePolicy)
+		//IAM 用户
+		adminRouter.Methods(http.MethodGet).Path("/users").HandlerFunc(admin.ListUsers)
+		adminRouter.Methods(http.MethodGet).Path("/users/{user}").HandlerFunc(admin.GetUser)
+		adminRouter.Methods(http.MethodPut).Path("/users/{user}").HandlerFunc(admin.PutUser)
+		adminRouter.Methods(http.MethodDelete).Path("/users/{user}").HandlerFunc(admin.DeleteUser)
+		//IAM 组
+		adminRouter.Methods(http.MethodGet).Path("/groups").HandlerFunc(admin.ListGroups)
+		adminRouter.Methods(http.MethodGet).Path("/groups/{group}").HandlerFunc(admin.GetGroup)
+		adminRouter.Methods(http.MethodPut).Path("/groups/{group}").HandlerFunc(admin.PutGroup)
+		adminRouter.Methods(http.MethodDelete).Path("/groups/{group}").HandlerFunc(admin.DeleteGroup)
+	}
+	//预签名 URL 生成
+	presignRouter.Methods(http.MethodPost).HandlerFunc(presign.Handle)
 	for _, router := range routers {
 		{
+			//CopyObjectPart
+			router.Methods(http.MethodPut).Path("/{object:.+}").HeadersRegexp("X-Amz-Copy-Source", ".*?(\\/|%2F).*?").Queries("partNumber", "{partNumber:[0-9]+}", "uploadId", "{uploadId:.*}").HandlerFunc(object.CopyObjectPart)
 			//PutObjectPart
+			router.Methods(http.MethodPut).Path("/{object:.+}").Queries("partNumber", "{partNumber:[0-9]+}", "uploadId", "{uploadId:.*}").HandlerFunc(object.PutObjectPart)
+			//ListObjectParts
+			router.Methods(http.MethodGet).Path("/{object:.+}").Queries("uploadId", "{uploadId:.*}").HandlerFunc(object.ListObjectParts)
+			//CompleteMultipartUpload
+			router.Methods(http.MethodPost).Path("/{object:.+}").Queries("uploadId", "{uploadId:.*}").HandlerFunc(object.CompleteMultipartUpload)
+			//NewMultipartUpload
+			router.Methods(http.MethodPost).Path("/{object:.+}").Queries("uploads", "").HandlerFunc(object.NewMultipartUpload)
+			//AbortMultipartUpload
+			router.Methods(http.MethodDelete).Path("/{object:.+}").Queries("uploadId", "{uploadId:.*}").HandlerFunc(object.AbortMultipartUpload)
+			//CopyObject
+			router.Methods(http.MethodPut).Path("/{object:.+}").HeadersRegexp("X-Amz-Copy-Source", ".*?(\\/|%2F).*?").HandlerFunc(object.CopyObject)
+			//PutObject
 			router.Methods(http.MethodPut).Path("/{object:.+}").HandlerFunc(object.Put)
 			//HeadObject
 			router.Methods(http.MethodHead).Path("/{object:.+}").HandlerFunc(object.Head)
@@ -52,22 +191,40 @@ func main() {
 			router.Methods(http.MethodDelete).Path("/{object:.+}").HandlerFunc(object.Delete)
 			//GetObject
 			router.Methods(http.MethodGet).Path("/{object:.+}").HandlerFunc(object.Get)
+			//GetBucketLocation, 需在 ListObjectsV1 之前匹配
+			router.Methods(http.MethodGet).Queries("location", "").HandlerFunc(bucket.Location)
+			//GetBucketPolicy
+			router.Methods(http.MethodGet).Queries("policy", "").HandlerFunc(bucket.GetPolicy)
+			//PutBucketPolicy
+			router.Methods(http.MethodPut).Queries("policy", "").HandlerFunc(bucket.PutPolicy)
+			//DeleteBucketPolicy
+			router.Methods(http.MethodDelete).Queries("policy", "").HandlerFunc(bucket.DeletePolicy)
+			//PostObject 浏览器表单上传
+			router.Methods(http.MethodPost).HeadersRegexp("Content-Type", "multipart/form-data.*").HandlerFunc(object.PostObject)
+			//DeleteMultipleObjects
+			router.Methods(http.MethodPost).Queries("delete", "").HandlerFunc(object.DeleteMultipleObjects)
+			//ListMultipartUploads
+			router.Methods(http.MethodGet).Queries("uploads", "").HandlerFunc(object.ListMultipartUploads)
+			//ListObjectsV2
+			router.Methods(http.MethodGet).Queries("list-type", "2").HandlerFunc(object.ListV2)
 			//ListObjectsV1
 			router.Methods(http.MethodGet).HandlerFunc(object.ListV1)
 		}
 		{
 			//bucket
-			router.Methods(http.MethodGet).Queries("location", "").HandlerFunc(bucket.Location)
 			router.Methods(http.MethodPut).HandlerFunc(bucket.Create)
 			router.Methods(http.MethodHead).HandlerFunc(bucket.Head)
 			router.Methods(http.MethodDelete).HandlerFunc(bucket.Delete)
 		}
 	}
 	router.Methods(http.MethodGet).Path(cmd.SlashSeparator).HandlerFunc(bucket.List)
+	//STS AssumeRole/GetSessionToken
+	router.Methods(http.MethodPost).Path(cmd.SlashSeparator).HeadersRegexp("Content-Type", "application/x-www-form-urlencoded.*").HandlerFunc(sts.Handle)
 
-	addr := ":8002"
+	addr := cmd.GlobalConfig.Http.Addr
+	logger.Info("s3gateway version %s commit %s build time %s", cmd.Version, cmd.CommitID, cmd.BuildTime)
 	logger.Info("http start listen:%s", addr)
-	if err := http.ListenAndServe(addr, router); err != nil {
-		log.Println(err.Error())
+	if err := http.ListenAndServe(addr, rootRouter); err != nil {
+		logger.Exit("http listen error:%s", err.Error())
 	}
 }
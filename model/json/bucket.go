@@ -11,6 +11,13 @@ type CreateBucket struct {
 	Base
 	Data struct{ DataBase } `json:"data"`
 }
+type HeadBucket struct {
+	Base
+	Data struct {
+		DataBase
+		Location string `json:"location"`
+	} `json:"data"`
+}
 type DeleteBucket struct {
 	Base
 	Data struct{ DataBase } `json:"data"`
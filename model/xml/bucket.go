@@ -9,6 +9,11 @@ type CreateBucket struct {
 	XMLName  xml.Name `xml:"CreateBucketConfiguration"`
 	Location string   `xml:"LocationConstraint"`
 }
+type LocationConstraint struct {
+	XMLName  xml.Name `xml:"LocationConstraint"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:",chardata"`
+}
 type Bucket struct {
 	XMLName      xml.Name  `xml:"Bucket"`
 	CreationDate time.Time `xml:"CreationDate"`
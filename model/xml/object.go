@@ -19,13 +19,92 @@ type ListObjectResultContent struct {
 	Owner        *ListObjectResultContentOwner `xml:"Owner"`
 }
 
+type CommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
 type ListObjectResult struct {
-	XMLName     xml.Name                   `xml:"ListBucketResult"`
-	Xmlns       string                     `xml:"xmlns,attr"`
-	Name        string                     `xml:"Name"`
-	Prefix      string                     `xml:"Prefix"`
-	Marker      string                     `xml:"Marker"`
-	MaxKeys     int                        `xml:"MaxKeys"`
-	IsTruncated bool                       `xml:"IsTruncated"`
-	Contents    []*ListObjectResultContent `xml:"Contents"`
+	XMLName        xml.Name                   `xml:"ListBucketResult"`
+	Xmlns          string                     `xml:"xmlns,attr"`
+	Name           string                     `xml:"Name"`
+	Prefix         string                     `xml:"Prefix"`
+	Marker         string                     `xml:"Marker"`
+	NextMarker     string                     `xml:"NextMarker,omitempty"`
+	MaxKeys        int                        `xml:"MaxKeys"`
+	Delimiter      string                     `xml:"Delimiter,omitempty"`
+	IsTruncated    bool                       `xml:"IsTruncated"`
+	EncodingType   string                     `xml:"EncodingType,omitempty"`
+	Contents       []*ListObjectResultContent `xml:"Contents"`
+	CommonPrefixes []CommonPrefix             `xml:"CommonPrefixes"`
+}
+
+type ListObjectV2Result struct {
+	XMLName               xml.Name                   `xml:"ListBucketResult"`
+	Xmlns                 string                     `xml:"xmlns,attr"`
+	Name                  string                     `xml:"Name"`
+	Prefix                string                     `xml:"Prefix"`
+	StartAfter            string                     `xml:"StartAfter,omitempty"`
+	ContinuationToken     string                     `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string                     `xml:"NextContinuationToken,omitempty"`
+	KeyCount              int                        `xml:"KeyCount"`
+	MaxKeys               int                        `xml:"MaxKeys"`
+	Delimiter             string                     `xml:"Delimiter,omitempty"`
+	IsTruncated           bool                       `xml:"IsTruncated"`
+	EncodingType          string                     `xml:"EncodingType,omitempty"`
+	Contents              []*ListObjectResultContent `xml:"Contents"`
+	CommonPrefixes        []CommonPrefix             `xml:"CommonPrefixes"`
+}
+
+type CopyObjectResult struct {
+	XMLName      xml.Name  `xml:"CopyObjectResult"`
+	Xmlns        string    `xml:"xmlns,attr"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag"`
+}
+
+type CopyObjectPartResult struct {
+	XMLName      xml.Name  `xml:"CopyPartResult"`
+	Xmlns        string    `xml:"xmlns,attr"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag"`
+}
+
+type ObjectToDelete struct {
+	Key       string `xml:"Key"`
+	VersionID string `xml:"VersionId,omitempty"`
+}
+
+// DeleteObjectsRequest DeleteObjects 请求体
+type DeleteObjectsRequest struct {
+	XMLName xml.Name         `xml:"Delete"`
+	Quiet   bool             `xml:"Quiet"`
+	Objects []ObjectToDelete `xml:"Object"`
+}
+
+type DeletedObject struct {
+	Key       string `xml:"Key"`
+	VersionID string `xml:"VersionId,omitempty"`
+}
+
+type DeleteError struct {
+	Key       string `xml:"Key"`
+	VersionID string `xml:"VersionId,omitempty"`
+	Code      string `xml:"Code"`
+	Message   string `xml:"Message"`
+}
+
+type DeleteObjectsResponse struct {
+	XMLName        xml.Name        `xml:"DeleteResult"`
+	Xmlns          string          `xml:"xmlns,attr"`
+	DeletedObjects []DeletedObject `xml:"Deleted"`
+	Errors         []DeleteError   `xml:"Error"`
+}
+
+// PostResponse 表单上传 success_action_status=201 时的响应
+type PostResponse struct {
+	XMLName  xml.Name `xml:"PostResponse"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+	Location string   `xml:"Location"`
 }
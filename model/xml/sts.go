@@ -0,0 +1,42 @@
+package xml
+
+import (
+	"encoding/xml"
+
+	"s3Gateway/internal/auth"
+)
+
+type STSResponseMetadata struct {
+	RequestID string `xml:"RequestId,omitempty"`
+}
+type AssumedRoleUser struct {
+	Arn           string `xml:"Arn"`
+	AssumedRoleID string `xml:"AssumeRoleId"`
+}
+type AssumeRoleResult struct {
+	AssumedRoleUser AssumedRoleUser  `xml:"AssumedRoleUser,omitempty"`
+	Credentials     auth.Credentials `xml:"Credentials"`
+}
+type AssumeRoleResponse struct {
+	XMLName          xml.Name            `xml:"https://sts.amazonaws.com/doc/2011-06-15/ AssumeRoleResponse"`
+	Result           AssumeRoleResult    `xml:"AssumeRoleResult"`
+	ResponseMetadata STSResponseMetadata `xml:"ResponseMetadata"`
+}
+type GetSessionTokenResult struct {
+	Credentials auth.Credentials `xml:"Credentials"`
+}
+type GetSessionTokenResponse struct {
+	XMLName          xml.Name              `xml:"https://sts.amazonaws.com/doc/2011-06-15/ GetSessionTokenResponse"`
+	Result           GetSessionTokenResult `xml:"GetSessionTokenResult"`
+	ResponseMetadata STSResponseMetadata   `xml:"ResponseMetadata"`
+}
+type STSError struct {
+	Type    string `xml:"Type"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+type STSErrorResponse struct {
+	XMLName   xml.Name `xml:"https://sts.amazonaws.com/doc/2011-06-15/ ErrorResponse"`
+	Error     STSError `xml:"Error"`
+	RequestID string   `xml:"RequestId"`
+}
@@ -1,15 +1,27 @@
 package yml
 
+import "time"
+
 type Config struct {
-	Http struct {
-		Addr      string `yaml:"addr"`
-		InfoLevel string `yaml:"info_level"`
+	Region string `yaml:"region"`
+	Http   struct {
+		Addr      string   `yaml:"addr"`
+		InfoLevel string   `yaml:"info_level"`
+		Domains   []string `yaml:"domains"`
 	} `yaml:"http"`
+	Log struct {
+		Format     string            `yaml:"format"`
+		Levels     map[string]string `yaml:"levels"`
+		File       string            `yaml:"file"`
+		MaxSize    int64             `yaml:"max_size"`
+		MaxBackups int               `yaml:"max_backups"`
+	} `yaml:"log"`
 	OpenApi struct {
-		Host   string `yaml:"host"`
-		AppId  string `yaml:"app_id"`
-		Secret string `yaml:"secret"`
-		Paths  struct {
+		Host       string `yaml:"host"`
+		AppId      string `yaml:"app_id"`
+		Secret     string `yaml:"secret"`
+		SecretFile string `yaml:"secret_file"`
+		Paths      struct {
 			UploadCredential string `yaml:"upload_credential"`
 			SecretByAppid    string `yaml:"secret_by_appid"`
 			UploadFile       string `yaml:"upload_file"`
@@ -24,4 +36,26 @@ type Config struct {
 			GetCid           string `yaml:"get_cid"`
 		} `yaml:"paths"`
 	} `yaml:"open_api"`
+	Backend struct {
+		Type string `yaml:"type"`
+		Fs   struct {
+			Root  string            `yaml:"root"`
+			Users map[string]string `yaml:"users"`
+		} `yaml:"fs"`
+	} `yaml:"backend"`
+	Multipart struct {
+		Dir    string        `yaml:"dir"`
+		Expiry time.Duration `yaml:"expiry"`
+	} `yaml:"multipart"`
+	Store struct {
+		Dir string `yaml:"dir"`
+	} `yaml:"store"`
+	Iam struct {
+		Enable bool     `yaml:"enable"`
+		Admins []string `yaml:"admins"`
+	} `yaml:"iam"`
+	Credentials struct {
+		TTL         time.Duration `yaml:"ttl"`
+		NegativeTTL time.Duration `yaml:"negative_ttl"`
+	} `yaml:"credentials"`
 }
@@ -0,0 +1,268 @@
+package yml
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"s3Gateway/internal/logger"
+)
+
+//配置加载顺序: 配置文件 < 环境变量 < 命令行 -set
+//环境变量名为 EnvPrefix + yaml 路径, 例如 http.addr 对应 S3GATEWAY_HTTP_ADDR
+
+const (
+	EnvPrefix = "S3GATEWAY"
+	// DefaultRegion 未配置 region 时使用
+	DefaultRegion = "us-east-1"
+	// DefaultStoreDir 未配置 store.dir 时使用
+	DefaultStoreDir = "./store"
+	// DefaultLogMaxSize 日志文件切割大小(MB)
+	DefaultLogMaxSize = 100
+)
+
+//Load 读取配置文件
+func Load(path string) (*Config, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open config %s: %w", path, err)
+	}
+	defer fp.Close()
+	c := &Config{}
+	if err := yaml.NewDecoder(fp).Decode(c); err != nil {
+		return nil, fmt.Errorf("decode config %s: %w", path, err)
+	}
+	return c, nil
+}
+
+//ApplyEnv 使用环境变量覆盖配置
+func (c *Config) ApplyEnv() error {
+	var errs []string
+	walkFields(reflect.ValueOf(c).Elem(), "", func(key string, v reflect.Value) {
+		name := EnvPrefix + "_" + strings.ToUpper(strings.NewReplacer(".", "_").Replace(key))
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+		if err := setValue(v, value); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", name, err.Error()))
+		}
+	})
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+//Set 按 yaml 路径设置配置项, 例如 Set("http.addr", ":9000")
+func (c *Config) Set(key, value string) error {
+	found := false
+	var err error
+	walkFields(reflect.ValueOf(c).Elem(), "", func(k string, v reflect.Value) {
+		if k == key {
+			found = true
+			err = setValue(v, value)
+		}
+	})
+	if !found {
+		return fmt.Errorf("unknown config key %q", key)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %s", key, err.Error())
+	}
+	return nil
+}
+
+//walkFields 遍历所有叶子字段, key 为 yaml 路径
+func walkFields(v reflect.Value, prefix string, fn func(key string, v reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			walkFields(field, key, fn)
+			continue
+		}
+		fn(key, field)
+	}
+}
+
+//setValue 字符串转换为字段类型. map 使用 k1=v1,k2=v2 格式, 切片使用逗号分隔
+func setValue(v reflect.Value, value string) error {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String || v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		m := make(map[string]string)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			kv := strings.SplitN(item, "=", 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("invalid map item %q, want key=value", item)
+			}
+			m[kv[0]] = kv[1]
+		}
+		v.Set(reflect.ValueOf(m))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+//Validate 校验配置并补全默认值, 返回所有错误
+func (c *Config) Validate() error {
+	var errs []string
+	addErr := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+
+	if c.Http.Addr == "" {
+		addErr("http.addr is required")
+	} else if _, port, err := net.SplitHostPort(c.Http.Addr); err != nil {
+		addErr("http.addr %q: %s", c.Http.Addr, err.Error())
+	} else if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		addErr("http.addr %q: invalid port", c.Http.Addr)
+	}
+	if _, err := logger.ParseLevel(c.Http.InfoLevel); err != nil {
+		addErr("http.info_level: %s", err.Error())
+	}
+	if format, err := logger.ParseFormat(c.Log.Format); err != nil {
+		addErr("log.format: %s", err.Error())
+	} else {
+		c.Log.Format = format
+	}
+	for pkg, level := range c.Log.Levels {
+		if _, err := logger.ParseLevel(level); err != nil {
+			addErr("log.levels.%s: %s", pkg, err.Error())
+		}
+	}
+	if c.Log.MaxSize < 0 {
+		addErr("log.max_size must not be negative")
+	} else if c.Log.MaxSize == 0 {
+		c.Log.MaxSize = DefaultLogMaxSize
+	}
+	if c.Log.MaxBackups < 0 {
+		addErr("log.max_backups must not be negative")
+	}
+	for i, domain := range c.Http.Domains {
+		domain = strings.ToLower(strings.Trim(domain, "."))
+		if domain == "" || strings.ContainsAny(domain, ":/") {
+			addErr("http.domains %q must be a host name without scheme or port", c.Http.Domains[i])
+			continue
+		}
+		c.Http.Domains[i] = domain
+	}
+
+	if c.Region == "" {
+		c.Region = DefaultRegion
+	} else if strings.Trim(c.Region, "abcdefghijklmnopqrstuvwxyz0123456789-") != "" {
+		addErr("region %q may only contain lowercase letters, digits and '-'", c.Region)
+	}
+
+	switch c.Backend.Type {
+	case "":
+		c.Backend.Type = "open_api"
+		fallthrough
+	case "open_api":
+		if c.OpenApi.Host == "" {
+			addErr("open_api.host is required")
+		} else if u, err := url.Parse(c.OpenApi.Host); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			addErr("open_api.host %q must be an http(s) url", c.OpenApi.Host)
+		}
+		paths := reflect.ValueOf(c.OpenApi.Paths)
+		for i := 0; i < paths.NumField(); i++ {
+			name := strings.Split(paths.Type().Field(i).Tag.Get("yaml"), ",")[0]
+			if paths.Field(i).String() == "" {
+				addErr("open_api.paths.%s is required", name)
+			}
+		}
+	case "fs":
+		if c.Backend.Fs.Root == "" {
+			addErr("backend.fs.root is required")
+		}
+		if len(c.Backend.Fs.Users) == 0 {
+			addErr("backend.fs.users must contain at least one access key")
+		}
+		for ak, sk := range c.Backend.Fs.Users {
+			if len(ak) < 3 || len(sk) < 8 {
+				addErr("backend.fs.users %q: access key must be at least 3 and secret key at least 8 characters", ak)
+			}
+		}
+	default:
+		addErr("backend.type %q must be open_api or fs", c.Backend.Type)
+	}
+
+	if c.Store.Dir == "" {
+		c.Store.Dir = DefaultStoreDir
+	}
+
+	if c.Iam.Enable && len(c.Iam.Admins) == 0 {
+		addErr("iam.admins must contain at least one access key when iam.enable is true")
+	}
+
+	if c.Multipart.Expiry < 0 {
+		addErr("multipart.expiry must not be negative")
+	}
+
+	if c.Credentials.TTL < 0 {
+		addErr("credentials.ttl must not be negative")
+	}
+	if c.Credentials.NegativeTTL < 0 {
+		addErr("credentials.negative_ttl must not be negative")
+	}
+
+	if len(errs) > 0 {
+		return errors.New("invalid config: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
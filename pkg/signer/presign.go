@@ -0,0 +1,84 @@
+package signer
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/s3utils"
+	xhttp "s3Gateway/internal/http"
+)
+
+//预签名 URL 生成, 与网关校验签名使用相同的计算过程
+
+const (
+	// MaxPresignExpiry V4 预签名 URL 的最长有效期
+	MaxPresignExpiry = 7 * 24 * time.Hour
+	// unsignedPayload 预签名请求不对请求体签名
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	serviceS3       = "s3"
+)
+
+// Credentials 签名使用的凭证, SessionToken 为 STS 临时凭证的 token
+type Credentials struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+//PresignV4 生成 V4 预签名 URL
+//u 为对象地址(Path 未编码), u.RawQuery 中的参数(如 response-*)一并签名;
+//header 为需要签名的请求头(如 PUT 时的 Content-Type), 使用 URL 时需要携带相同的请求头
+func PresignV4(method string, u url.URL, region string, cred Credentials, header http.Header, t time.Time, expires time.Duration) string {
+	t = t.UTC()
+	scope := Scope(t, region, serviceS3)
+	query := u.Query()
+	query.Set(xhttp.AmzAlgorithm, SignV4Algorithm)
+	query.Set(xhttp.AmzCredential, cred.AccessKey+"/"+scope)
+	query.Set(xhttp.AmzDate, t.Format(ISO8601Format))
+	query.Set(xhttp.AmzExpires, strconv.FormatInt(int64(expires/time.Second), 10))
+	if cred.SessionToken != "" {
+		query.Set(xhttp.AmzSecurityToken, cred.SessionToken)
+	}
+	signedHeaders := make(http.Header, len(header)+1)
+	for k, v := range header {
+		signedHeaders[http.CanonicalHeaderKey(k)] = v
+	}
+	signedHeaders.Set("Host", u.Host)
+	query.Set(xhttp.AmzSignedHeaders, SignedHeaders(signedHeaders))
+
+	canonicalRequest := CanonicalRequest(signedHeaders, unsignedPayload, query.Encode(), u.Path, method)
+	signature := Signature(SigningKey(cred.SecretKey, t, region, serviceS3), StringToSign(canonicalRequest, t, scope))
+	query.Set(xhttp.AmzSignature, signature)
+	return presignedURL(u, query.Encode())
+}
+
+//PresignV2 生成 V2 预签名 URL, expires 为 URL 失效的时间点
+//u 及 header 的含义与 PresignV4 相同
+func PresignV2(method string, u url.URL, cred Credentials, header http.Header, expires time.Time) string {
+	expiresStr := strconv.FormatInt(expires.Unix(), 10)
+	//签名时使用未转义的查询参数, 与校验时一致
+	var queries []string
+	for k, vs := range u.Query() {
+		for _, v := range vs {
+			queries = append(queries, k+"="+v)
+		}
+	}
+	stringToSign := StringToSignV2(method, s3utils.EncodePath(u.Path), strings.Join(queries, "&"), header, expiresStr)
+
+	query := u.Query()
+	query.Set(xhttp.AmzAccessKeyID, cred.AccessKey)
+	query.Set(xhttp.Expires, expiresStr)
+	query.Set(xhttp.AmzSignatureV2, SignatureV2(stringToSign, cred.SecretKey))
+	if cred.SessionToken != "" {
+		query.Set(xhttp.AmzSecurityToken, cred.SessionToken)
+	}
+	return presignedURL(u, query.Encode())
+}
+
+//presignedURL 路径按 s3 规则编码, 查询参数中的空格编码为 %20
+func presignedURL(u url.URL, rawQuery string) string {
+	return u.Scheme + "://" + u.Host + s3utils.EncodePath(u.Path) + "?" + strings.Replace(rawQuery, "+", "%20", -1)
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2015-2021 MinIO, Inc.
+//
+// This file is part of MinIO Object Storage stack
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package signer implements the AWS Signature Version '2' and '4'
+// calculations shared by the gateway's signature verification and
+// presigned URL generation.
+package signer
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/s3utils"
+)
+
+// AWS Signature Version '4' constants.
+const (
+	SignV4Algorithm = "AWS4-HMAC-SHA256"
+	ISO8601Format   = "20060102T150405Z"
+	YYYYMMDD        = "20060102"
+)
+
+// CanonicalHeaders generate a list of request headers with their values
+func CanonicalHeaders(signedHeaders http.Header) string {
+	var headers []string
+	vals := make(http.Header)
+	for k, vv := range signedHeaders {
+		headers = append(headers, strings.ToLower(k))
+		vals[strings.ToLower(k)] = vv
+	}
+	sort.Strings(headers)
+
+	var buf bytes.Buffer
+	for _, k := range headers {
+		buf.WriteString(k)
+		buf.WriteByte(':')
+		for idx, v := range vals[k] {
+			if idx > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(TrimAll(v))
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+// SignedHeaders generate a string i.e alphabetically sorted, semicolon-separated list of lowercase request header names
+func SignedHeaders(signedHeaders http.Header) string {
+	var headers []string
+	for k := range signedHeaders {
+		headers = append(headers, strings.ToLower(k))
+	}
+	sort.Strings(headers)
+	return strings.Join(headers, ";")
+}
+
+// CanonicalRequest generate a canonical request of style
+//
+// canonicalRequest =
+//  <HTTPMethod>\n
+//  <CanonicalURI>\n
+//  <CanonicalQueryString>\n
+//  <CanonicalHeaders>\n
+//  <SignedHeaders>\n
+//  <HashedPayload>
+//
+// CanonicalURI is the path as sent by the client, for virtual-host-style
+// requests it does not contain the bucket name.
+func CanonicalRequest(extractedSignedHeaders http.Header, payload, queryStr, urlPath, method string) string {
+	rawQuery := strings.Replace(queryStr, "+", "%20", -1)
+	if urlPath == "" {
+		urlPath = "/"
+	}
+	encodedPath := s3utils.EncodePath(urlPath)
+	canonicalRequest := strings.Join([]string{
+		method,
+		encodedPath,
+		rawQuery,
+		CanonicalHeaders(extractedSignedHeaders),
+		SignedHeaders(extractedSignedHeaders),
+		payload,
+	}, "\n")
+	return canonicalRequest
+}
+
+// Scope generate a string of a specific date, an AWS region, and a service.
+func Scope(t time.Time, region, service string) string {
+	scope := strings.Join([]string{
+		t.Format(YYYYMMDD),
+		region,
+		service,
+		"aws4_request",
+	}, "/")
+	return scope
+}
+
+// StringToSign a string based on selected query values.
+func StringToSign(canonicalRequest string, t time.Time, scope string) string {
+	stringToSign := SignV4Algorithm + "\n" + t.Format(ISO8601Format) + "\n"
+	stringToSign = stringToSign + scope + "\n"
+	canonicalRequestBytes := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign = stringToSign + hex.EncodeToString(canonicalRequestBytes[:])
+	return stringToSign
+}
+
+// SigningKey hmac seed to calculate final signature.
+func SigningKey(secretKey string, t time.Time, region, service string) []byte {
+	date := SumHMAC([]byte("AWS4"+secretKey), []byte(t.Format(YYYYMMDD)))
+	regionBytes := SumHMAC(date, []byte(region))
+	serviceBytes := SumHMAC(regionBytes, []byte(service))
+	signingKey := SumHMAC(serviceBytes, []byte("aws4_request"))
+	return signingKey
+}
+
+// Signature final signature in hexadecimal form.
+func Signature(signingKey []byte, stringToSign string) string {
+	return hex.EncodeToString(SumHMAC(signingKey, []byte(stringToSign)))
+}
+
+// SumHMAC calculate hmac between two input byte array.
+func SumHMAC(key []byte, data []byte) []byte {
+	hash := hmac.New(sha256.New, key)
+	hash.Write(data)
+	return hash.Sum(nil)
+}
+
+// TrimAll trim leading and trailing spaces and replace sequential spaces with one space, following Trimall()
+// in http://docs.aws.amazon.com/general/latest/gr/sigv4-create-canonical-request.html
+func TrimAll(input string) string {
+	// Compress adjacent spaces (a space is determined by
+	// unicode.IsSpace() internally here) to one space and return
+	return strings.Join(strings.Fields(input), " ")
+}